@@ -0,0 +1,62 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+)
+
+//specYAML описание API в формате OpenAPI 3. Тесты контроллера проверяют ответы обработчиков по нему
+//
+//go:embed openapi.yaml
+var specYAML []byte
+
+//specJSON описание API в формате JSON для /openapi.json
+var specJSON = func() []byte {
+	var doc interface{}
+	if err := yaml.Unmarshal(specYAML, &doc); err != nil {
+		panic("api: openapi.yaml: " + err.Error())
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		panic("api: openapi.yaml: " + err.Error())
+	}
+	return data
+}()
+
+//Spec описание API в формате OpenAPI 3 (JSON)
+func Spec() []byte {
+	return specJSON
+}
+
+//SpecHandler обработка запросов GET /openapi.json
+func SpecHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(specJSON)
+}
+
+//docsPage Swagger UI для /openapi.json. Скрипты загружаются из CDN
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Merchant API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
+
+//DocsHandler обработка запросов GET /docs: Swagger UI
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
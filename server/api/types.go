@@ -0,0 +1,169 @@
+package api
+
+import (
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+//Типы запросов и ответов API. Их используют обработчики сервера и пакет client
+
+//Task состояние задачи импорта
+type Task struct {
+	TaskID        int64  `json:"task_id"`
+	Status        string `json:"status"`
+	ElapsedTime   string `json:"elapsed_time"`
+	LinesParsed   int    `json:"lines_parsed"`
+	NewOffers     int    `json:"new_offers"`
+	UpdatedOffers int    `json:"updated_offers"`
+	Errors        int    `json:"errors"`
+	DeletedOffers int    `json:"deleted_offers,omitempty"`
+}
+
+//Done задача завершена и больше не изменится
+func (t Task) Done() bool {
+	return t.Status != store.TaskProcessing && t.Status != store.TaskQueued
+}
+
+//ImportRequest запрос на загрузку xlsx файла по ссылке.
+//DryRun только сравнивает файл с текущими товарами и сохраняет изменения для просмотра, Replace удаляет товары, которых нет в файле
+type ImportRequest struct {
+	URL      string `json:"url"`
+	SellerID int    `json:"seller_id"`
+	Async    bool   `json:"async"`
+	DryRun   bool   `json:"dry_run,omitempty"`
+	Replace  bool   `json:"replace,omitempty"`
+}
+
+//Validate проверяет обязательные поля и возвращает ошибки всех полей
+func (req ImportRequest) Validate() []FieldError {
+	var errs []FieldError
+	if req.URL == "" {
+		errs = append(errs, FieldError{"url", "url is required"})
+	}
+	if req.SellerID == 0 {
+		errs = append(errs, FieldError{"seller_id", "seller_id is required"})
+	} else if req.SellerID < 0 {
+		errs = append(errs, FieldError{"seller_id", "seller_id must be positive"})
+	}
+	return errs
+}
+
+//Accepted ответ 202 на запуск асинхронного импорта
+type Accepted struct {
+	TaskID    int64  `json:"task_id"`
+	Status    string `json:"status"`
+	StatusURL string `json:"status_url"`
+	EventsURL string `json:"events_url"`
+}
+
+//Preview страница изменений пробного импорта. Total число всех изменений задачи
+type Preview struct {
+	TaskID  int64           `json:"task_id"`
+	Status  string          `json:"status"`
+	Total   int             `json:"total"`
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+	Changes []PreviewChange `json:"changes"`
+}
+
+//Действия PreviewChange
+const (
+	ActionInsert = "insert"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+//PreviewChange изменение одного товара: old нет у нового товара, new нет у удаляемого,
+//fields перечисляет измененные поля обновляемого товара
+type PreviewChange struct {
+	Action  string        `json:"action"`
+	OfferID int           `json:"offer_id"`
+	Old     *parser.Offer `json:"old,omitempty"`
+	New     *parser.Offer `json:"new,omitempty"`
+	Fields  []FieldChange `json:"fields,omitempty"`
+}
+
+//RevertConflict товар, измененный после отменяемой задачи: expected оставила задача, current сейчас в базе.
+//Нет expected или current, если товара нет
+type RevertConflict struct {
+	OfferID  int           `json:"offer_id"`
+	Expected *parser.Offer `json:"expected,omitempty"`
+	Current  *parser.Offer `json:"current,omitempty"`
+}
+
+//FieldChange старое и новое значение поля товара. В разнице задач у цены и количества есть delta,
+//у цены percent, если старая цена не 0
+type FieldChange struct {
+	Field   string      `json:"field"`
+	Old     interface{} `json:"old"`
+	New     interface{} `json:"new"`
+	Delta   *float64    `json:"delta,omitempty"`
+	Percent *float64    `json:"percent,omitempty"`
+}
+
+//TaskDiff разница между товарами продавца после задачи from_task_id и после задачи to_task_id:
+//added новых, removed удаленных и changed измененных товаров, changes страница изменений
+type TaskDiff struct {
+	FromTaskID int64           `json:"from_task_id"`
+	ToTaskID   int64           `json:"to_task_id"`
+	SellerID   int             `json:"seller_id"`
+	Added      int             `json:"added"`
+	Removed    int             `json:"removed"`
+	Changed    int             `json:"changed"`
+	Offset     int             `json:"offset"`
+	Limit      int             `json:"limit"`
+	Changes    []PreviewChange `json:"changes"`
+}
+
+//OfferEvent изменение товара в истории: action, old, new и fields как в PreviewChange.
+//task_id задачи импорта или запроса к отдельному товару, который записал изменение
+type OfferEvent struct {
+	ID        int64         `json:"id"`
+	TaskID    int64         `json:"task_id,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	Action    string        `json:"action"`
+	Old       *parser.Offer `json:"old,omitempty"`
+	New       *parser.Offer `json:"new,omitempty"`
+	Fields    []FieldChange `json:"fields,omitempty"`
+}
+
+//SellerInput новый продавец. Пустой status означает store.SellerActive
+type SellerInput struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+//SellerPatch частичное обновление продавца, отсутствующие поля не меняются
+type SellerPatch struct {
+	Name   *string `json:"name,omitempty"`
+	Email  *string `json:"email,omitempty"`
+	Status *string `json:"status,omitempty"`
+}
+
+//ErrorResponse тело любого ответа с ошибкой
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+//Error описание ошибки: code машиночитаемый и зависит только от кода ответа, message для человека,
+//details уточняет ошибку, например неверные поля, request_id совпадает с заголовком X-Request-ID
+type Error struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+//FieldError неверное поле запроса в details
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
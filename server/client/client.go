@@ -0,0 +1,419 @@
+//Package client клиент API сервиса товаров. Использует типы запросов и ответов сервера из пакетов api, store и parser
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+//XLSXType Content-Type xlsx файла для UploadFile и ExportOffers
+const XLSXType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+//Client клиент API. Безопасен для одновременного использования
+type Client struct {
+	baseURL      string
+	apiKey       string
+	httpClient   *http.Client
+	retries      int
+	backoff      time.Duration
+	pollInterval time.Duration
+}
+
+//Option настройка клиента для New
+type Option func(*Client)
+
+//WithAPIKey передает ключ key в заголовке X-API-Key каждого запроса
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+//WithHTTPClient выполняет запросы через hc вместо http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+//WithRetries повторяет запрос до retries раз, если сервер временно недоступен.
+//Перед каждым повтором клиент ждет backoff, увеличивая паузу вдвое, или сколько сказано в заголовке Retry-After
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) { c.retries, c.backoff = retries, backoff }
+}
+
+//WithPollInterval как часто WaitForTask запрашивает состояние задачи
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Client) { c.pollInterval = interval }
+}
+
+//New создает клиент API по адресу baseURL, например http://localhost:8000.
+//По умолчанию запрос повторяется 3 раза начиная с паузы 200ms, а WaitForTask опрашивает задачу раз в 500ms
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		retries:      3,
+		backoff:      200 * time.Millisecond,
+		pollInterval: 500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+//Error ответ API с ошибкой
+type Error struct {
+	StatusCode int
+	Body       api.Error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("merchant api: %d %s", e.StatusCode, e.Body.Message)
+}
+
+//ImportFromURL запускает в фоне импорт xlsx файла по ссылке fileURL для продавца sellerID.
+//Итог импорта можно дождаться через WaitForTask
+func (c *Client) ImportFromURL(ctx context.Context, sellerID int, fileURL string) (*api.Accepted, error) {
+	return c.Import(ctx, sellerID, api.ImportRequest{URL: fileURL})
+}
+
+//Import запускает в фоне импорт по запросу req для продавца sellerID, поля SellerID и Async не учитываются.
+//Пробный импорт (DryRun) завершается статусом store.TaskPreview, его изменения возвращает PreviewTask
+func (c *Client) Import(ctx context.Context, sellerID int, req api.ImportRequest) (*api.Accepted, error) {
+	req.SellerID, req.Async = 0, true
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var accepted api.Accepted
+	err = c.doJSON(ctx, http.MethodPost, sellerPath(sellerID, "/offers"), "application/json", body, &accepted, http.StatusAccepted)
+	return &accepted, err
+}
+
+//UploadFile загружает xlsx файл из r для продавца sellerID и запускает импорт в фоне.
+//Итог импорта можно дождаться через WaitForTask
+func (c *Client) UploadFile(ctx context.Context, sellerID int, r io.Reader) (*api.Accepted, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var accepted api.Accepted
+	err = c.doJSON(ctx, http.MethodPost, sellerPath(sellerID, "/offers?async=true"), XLSXType, body, &accepted, http.StatusAccepted)
+	return &accepted, err
+}
+
+//GetTask возвращает состояние задачи импорта
+func (c *Client) GetTask(ctx context.Context, taskID int64) (*api.Task, error) {
+	var task api.Task
+	err := c.doJSON(ctx, http.MethodGet, "/v1/tasks/"+strconv.FormatInt(taskID, 10), "", nil, &task, http.StatusOK)
+	//задача, которой не удалось загрузить файл, приходит с кодом 400
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest && task.TaskID == taskID {
+		return &task, nil
+	}
+	return &task, err
+}
+
+//WaitForTask ждет завершения задачи импорта и возвращает ее итог.
+//Ошибкой завершения задачи считается только ошибка запроса, статус задачи нужно проверять по Task.Status
+func (c *Client) WaitForTask(ctx context.Context, taskID int64) (*api.Task, error) {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+	for {
+		task, err := c.GetTask(ctx, taskID)
+		if err != nil || task.Done() {
+			return task, err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return task, ctx.Err()
+		}
+	}
+}
+
+//ListTasks возвращает задачи по возрастанию ID, нулевые поля filter не учитываются
+func (c *Client) ListTasks(ctx context.Context, filter store.TaskFilter) ([]api.Task, error) {
+	query := url.Values{}
+	if filter.SellerID != 0 {
+		query.Set("seller_id", strconv.Itoa(filter.SellerID))
+	}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+	var tasks []api.Task
+	err := c.doJSON(ctx, http.MethodGet, "/v1/tasks?"+query.Encode(), "", nil, &tasks, http.StatusOK)
+	return tasks, err
+}
+
+//CancelTask отменяет выполняемую или ждущую в очереди задачу и возвращает ее итог
+func (c *Client) CancelTask(ctx context.Context, taskID int64) (*api.Task, error) {
+	var task api.Task
+	err := c.doJSON(ctx, http.MethodPost, "/v1/tasks/"+strconv.FormatInt(taskID, 10)+"/cancel", "", nil, &task, http.StatusOK)
+	return &task, err
+}
+
+//PreviewTask возвращает не больше limit изменений пробного импорта, начиная с offset. limit 0 означает размер страницы сервера
+func (c *Client) PreviewTask(ctx context.Context, taskID int64, offset, limit int) (*api.Preview, error) {
+	query := url.Values{}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/v1/tasks/" + strconv.FormatInt(taskID, 10) + "/preview"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var preview api.Preview
+	err := c.doJSON(ctx, http.MethodGet, path, "", nil, &preview, http.StatusOK)
+	return &preview, err
+}
+
+//ApplyTask записывает изменения пробного импорта. Если товары изменились после него, возвращает *Error с кодом 409
+func (c *Client) ApplyTask(ctx context.Context, taskID int64) (*api.Task, error) {
+	var task api.Task
+	err := c.doJSON(ctx, http.MethodPost, "/v1/tasks/"+strconv.FormatInt(taskID, 10)+"/apply", "", nil, &task, http.StatusOK)
+	return &task, err
+}
+
+//RevertTask возвращает товары, измененные задачей, в состояние до нее и возвращает задачу отмены.
+//Если товары изменились после задачи, без force возвращает *Error с кодом 409 и этими товарами в Body.Details
+func (c *Client) RevertTask(ctx context.Context, taskID int64, force bool) (*api.Task, error) {
+	path := "/v1/tasks/" + strconv.FormatInt(taskID, 10) + "/revert"
+	if force {
+		path += "?force=true"
+	}
+	var task api.Task
+	err := c.doJSON(ctx, http.MethodPost, path, "", nil, &task, http.StatusOK)
+	return &task, err
+}
+
+//SearchOffers ищет товары, нулевые поля search не учитываются
+func (c *Client) SearchOffers(ctx context.Context, search store.OfferSearch) ([]parser.Offer, error) {
+	query := url.Values{}
+	if search.SellerID != 0 {
+		query.Set("seller_id", strconv.Itoa(search.SellerID))
+	}
+	if search.OfferID != 0 {
+		query.Set("offer_id", strconv.Itoa(search.OfferID))
+	}
+	if search.NameSearch != "" {
+		query.Set("q", search.NameSearch)
+	}
+	if !search.AsOf.IsZero() {
+		query.Set("as_of", search.AsOf.UTC().Format(time.RFC3339Nano))
+	}
+	var offers []parser.Offer
+	err := c.doJSON(ctx, http.MethodGet, "/v1/offers?"+query.Encode(), "", nil, &offers, http.StatusOK)
+	return offers, err
+}
+
+//OfferHistory возвращает изменения товара от старых к новым
+func (c *Client) OfferHistory(ctx context.Context, sellerID, offerID int) ([]api.OfferEvent, error) {
+	var events []api.OfferEvent
+	err := c.doJSON(ctx, http.MethodGet, sellerPath(sellerID, "/offers/"+strconv.Itoa(offerID)+"/history"), "", nil, &events, http.StatusOK)
+	return events, err
+}
+
+//ExportOffers записывает в w все товары продавца в xlsx файле, который можно снова загрузить через UploadFile
+func (c *Client) ExportOffers(ctx context.Context, sellerID int, w io.Writer) error {
+	return c.download(ctx, sellerPath(sellerID, "/offers:export"), w)
+}
+
+//DiffTasks возвращает не больше limit изменений товаров продавца между задачами fromID и toID, начиная с offset.
+//limit 0 означает размер страницы сервера
+func (c *Client) DiffTasks(ctx context.Context, fromID, toID int64, offset, limit int) (*api.TaskDiff, error) {
+	query := url.Values{}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/v1/tasks/" + strconv.FormatInt(fromID, 10) + "/diff/" + strconv.FormatInt(toID, 10)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var diff api.TaskDiff
+	err := c.doJSON(ctx, http.MethodGet, path, "", nil, &diff, http.StatusOK)
+	return &diff, err
+}
+
+//ExportTaskDiff записывает в w все изменения товаров между задачами fromID и toID в xlsx файле
+func (c *Client) ExportTaskDiff(ctx context.Context, fromID, toID int64, w io.Writer) error {
+	return c.download(ctx, "/v1/tasks/"+strconv.FormatInt(fromID, 10)+"/diff/"+strconv.FormatInt(toID, 10)+"?format=xlsx", w)
+}
+
+//download записывает в w тело ответа на GET запрос path
+func (c *Client) download(ctx context.Context, path string, w io.Writer) error {
+	resp, err := c.do(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return responseError(resp.StatusCode, data, nil)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+//ListSellers возвращает продавцов, доступных ключу клиента
+func (c *Client) ListSellers(ctx context.Context) ([]store.Seller, error) {
+	var sellers []store.Seller
+	err := c.doJSON(ctx, http.MethodGet, "/v1/sellers", "", nil, &sellers, http.StatusOK)
+	return sellers, err
+}
+
+//GetSeller возвращает продавца
+func (c *Client) GetSeller(ctx context.Context, sellerID int) (*store.Seller, error) {
+	var seller store.Seller
+	err := c.doJSON(ctx, http.MethodGet, sellerPath(sellerID, ""), "", nil, &seller, http.StatusOK)
+	return &seller, err
+}
+
+//CreateSeller добавляет продавца
+func (c *Client) CreateSeller(ctx context.Context, input api.SellerInput) (*store.Seller, error) {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var seller store.Seller
+	err = c.doJSON(ctx, http.MethodPost, "/v1/sellers", "application/json", body, &seller, http.StatusCreated)
+	return &seller, err
+}
+
+//UpdateSeller меняет поля продавца, заданные в patch
+func (c *Client) UpdateSeller(ctx context.Context, sellerID int, patch api.SellerPatch) (*store.Seller, error) {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	var seller store.Seller
+	err = c.doJSON(ctx, http.MethodPatch, sellerPath(sellerID, ""), "application/json", body, &seller, http.StatusOK)
+	return &seller, err
+}
+
+//DeleteSeller удаляет продавца вместе с его товарами, задачами и ключами
+func (c *Client) DeleteSeller(ctx context.Context, sellerID int) error {
+	return c.doJSON(ctx, http.MethodDelete, sellerPath(sellerID, ""), "", nil, nil, http.StatusNoContent)
+}
+
+func sellerPath(sellerID int, suffix string) string {
+	return "/v1/sellers/" + strconv.Itoa(sellerID) + suffix
+}
+
+//doJSON выполняет запрос и разбирает ответ с кодом want в out. Ответ с другим кодом возвращается как *Error
+func (c *Client) doJSON(ctx context.Context, method, path, contentType string, body []byte, out interface{}, want int) error {
+	resp, err := c.do(ctx, method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != want {
+		return responseError(resp.StatusCode, data, out)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+//responseError ошибка из ответа с кодом statusCode и телом data.
+//Если тело 400 не конверт ошибки, оно разбирается в out: так приходит задача, которой не удалось загрузить файл
+func responseError(statusCode int, data []byte, out interface{}) *Error {
+	apiErr := &Error{StatusCode: statusCode}
+	var errResp api.ErrorResponse
+	if json.Unmarshal(data, &errResp) == nil && errResp.Error.Code != "" {
+		apiErr.Body = errResp.Error
+		return apiErr
+	}
+	apiErr.Body = api.Error{Code: strconv.Itoa(statusCode), Message: http.StatusText(statusCode)}
+	if statusCode == http.StatusBadRequest && out != nil {
+		json.Unmarshal(data, out)
+	}
+	return apiErr
+}
+
+//do выполняет запрос, повторяя его, если сервер временно недоступен.
+//Запросы POST и PATCH повторяются, только если сервер их точно не выполнял: на ответ 429
+//и если не удалось подключиться. 503 сервер может вернуть и после записи изменений, например
+//когда не записалось состояние задачи, поэтому такие запросы на 503 не повторяются
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if c.apiKey != "" {
+			req.Header.Set("X-API-Key", c.apiKey)
+		}
+		resp, err := c.httpClient.Do(req)
+		if attempt >= c.retries || !retryable(method, resp, err) {
+			return resp, err
+		}
+		wait := backoff
+		backoff *= 2
+		if resp != nil {
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(seconds) * time.Second
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+//retryable можно ли повторить запрос method, получивший ответ resp или ошибку err
+func retryable(method string, resp *http.Response, err error) bool {
+	idempotent := method != http.MethodPost && method != http.MethodPatch
+	if err != nil {
+		return idempotent || notConnected(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+//notConnected ошибка подключения к серверу: запрос не был отправлен
+func notConnected(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/controller"
+	"github.com/goserg/Golang-merchant-API/store"
+	"github.com/goserg/Golang-merchant-API/store/memory"
+)
+
+//newServer запускает сервер API на хранилище в памяти с ключом администратора admin-secret
+func newServer(t *testing.T) *httptest.Server {
+	c := controller.NewController(memory.New())
+	c.SetAdminKey("admin-secret")
+	mux := http.NewServeMux()
+	c.Routes(mux, nil)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newClient(srv *httptest.Server) *Client {
+	return New(srv.URL, WithAPIKey("admin-secret"), WithPollInterval(10*time.Millisecond), WithRetries(3, time.Millisecond))
+}
+
+func TestImportAndExport(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(newServer(t))
+	excels := httptest.NewServer(http.FileServer(http.Dir("../../mock_excel_api/excels")))
+	defer excels.Close()
+
+	seller, err := c.CreateSeller(ctx, api.SellerInput{ID: 3, Name: "Shop"})
+	if err != nil || seller.Status != store.SellerActive {
+		t.Fatalf("CreateSeller returned %+v, %v", seller, err)
+	}
+	beforeImport := time.Now()
+	accepted, err := c.ImportFromURL(ctx, 3, excels.URL+"/1.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := c.WaitForTask(ctx, accepted.TaskID)
+	if err != nil || task.Status != "Finished" || task.NewOffers == 0 {
+		t.Fatalf("import finished with %+v, %v", task, err)
+	}
+	imported := task.TaskID
+	offers, err := c.SearchOffers(ctx, store.OfferSearch{SellerID: 3})
+	if err != nil || len(offers) != task.NewOffers {
+		t.Fatalf("SearchOffers returned %d offers, %v, want %d", len(offers), err, task.NewOffers)
+	}
+	events, err := c.OfferHistory(ctx, 3, offers[0].OfferID)
+	if err != nil || len(events) != 1 || events[0].Action != api.ActionInsert || events[0].TaskID != task.TaskID {
+		t.Errorf("OfferHistory returned %+v, %v", events, err)
+	}
+	var apiErr *Error
+	if _, err := c.SearchOffers(ctx, store.OfferSearch{SellerID: 3, AsOf: beforeImport}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("SearchOffers before import returned %v", err)
+	}
+
+	var file bytes.Buffer
+	if err := c.ExportOffers(ctx, 3, &file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateSeller(ctx, api.SellerInput{ID: 4}); err != nil {
+		t.Fatal(err)
+	}
+	accepted, err = c.UploadFile(ctx, 4, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err = c.WaitForTask(ctx, accepted.TaskID)
+	if err != nil || task.NewOffers != len(offers) || task.Errors != 0 {
+		t.Fatalf("upload of exported file finished with %+v, %v, want %d new offers", task, err, len(offers))
+	}
+
+	diff, err := c.DiffTasks(ctx, imported, task.TaskID, 0, 0)
+	if err == nil || diff == nil {
+		t.Errorf("diff of tasks of different sellers returned %+v, %v", diff, err)
+	}
+	file.Reset()
+	if err := c.ExportTaskDiff(ctx, task.TaskID, task.TaskID, &file); err != nil || file.Len() == 0 {
+		t.Errorf("ExportTaskDiff returned %d bytes, %v", file.Len(), err)
+	}
+
+	accepted, err = c.ImportFromURL(ctx, 3, "http://127.0.0.1:1/missing.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err = c.WaitForTask(ctx, accepted.TaskID)
+	if err != nil || task.Status != "ERROR: Parsing error. Cannot load file" {
+		t.Errorf("failed import returned %+v, %v", task, err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(newServer(t))
+	excels := httptest.NewServer(http.FileServer(http.Dir("../../mock_excel_api/excels")))
+	defer excels.Close()
+
+	if _, err := c.CreateSeller(ctx, api.SellerInput{ID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := c.Import(ctx, 3, api.ImportRequest{URL: excels.URL + "/1.xlsx", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := c.WaitForTask(ctx, accepted.TaskID)
+	if err != nil || task.Status != store.TaskPreview || task.NewOffers == 0 {
+		t.Fatalf("dry run finished with %+v, %v", task, err)
+	}
+	preview, err := c.PreviewTask(ctx, task.TaskID, 1, 2)
+	if err != nil || preview.Total != task.NewOffers || len(preview.Changes) != 2 || preview.Changes[0].Action != api.ActionInsert {
+		t.Fatalf("PreviewTask returned %+v, %v", preview, err)
+	}
+	if _, err := c.SearchOffers(ctx, store.OfferSearch{SellerID: 3}); err == nil {
+		t.Error("dry run wrote offers")
+	}
+	task, err = c.ApplyTask(ctx, task.TaskID)
+	if err != nil || task.Status != store.TaskApplied {
+		t.Fatalf("ApplyTask returned %+v, %v", task, err)
+	}
+	offers, err := c.SearchOffers(ctx, store.OfferSearch{SellerID: 3})
+	if err != nil || len(offers) != task.NewOffers {
+		t.Errorf("SearchOffers after apply returned %d offers, %v, want %d", len(offers), err, task.NewOffers)
+	}
+	_, err = c.ApplyTask(ctx, task.TaskID)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("second ApplyTask returned %v", err)
+	}
+}
+
+func TestSellers(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(newServer(t))
+
+	if _, err := c.CreateSeller(ctx, api.SellerInput{ID: 5, Email: "shop@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	name := "New name"
+	seller, err := c.UpdateSeller(ctx, 5, api.SellerPatch{Name: &name})
+	if err != nil || seller.Name != name || seller.Email != "shop@example.com" {
+		t.Fatalf("UpdateSeller returned %+v, %v", seller, err)
+	}
+	sellers, err := c.ListSellers(ctx)
+	if err != nil || len(sellers) != 1 {
+		t.Fatalf("ListSellers returned %+v, %v", sellers, err)
+	}
+	if err := c.DeleteSeller(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.GetSeller(ctx, 5)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Body.Code != "not_found" {
+		t.Errorf("GetSeller of deleted seller returned %v", err)
+	}
+	_, err = c.CreateSeller(ctx, api.SellerInput{ID: 6, Email: "wrong"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Body.Details == nil {
+		t.Errorf("CreateSeller with wrong email returned %v", err)
+	}
+	_, err = New(c.baseURL).ListSellers(ctx)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("request without key returned %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t)
+	var calls atomic.Int32
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(int(status.Load()))
+			return
+		}
+		req, _ := http.NewRequestWithContext(r.Context(), r.Method, srv.URL+r.URL.RequestURI(), r.Body)
+		req.Header = r.Header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		w.Write(buf.Bytes())
+	}))
+	defer flaky.Close()
+
+	c := newClient(flaky)
+	if _, err := c.ListSellers(ctx); err != nil {
+		t.Fatalf("ListSellers after two unavailable responses: %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("server got %d requests, want 3", calls.Load())
+	}
+
+	//сервер может ответить 503 и после записи, поэтому POST не повторяется
+	calls.Store(0)
+	_, err := c.CreateSeller(ctx, api.SellerInput{ID: 7})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("CreateSeller returned %v after %d requests, want 503 after 1", err, calls.Load())
+	}
+	calls.Store(0)
+	status.Store(http.StatusTooManyRequests)
+	if _, err := c.CreateSeller(ctx, api.SellerInput{ID: 7}); err != nil || calls.Load() != 3 {
+		t.Errorf("CreateSeller after two 429 responses returned %v after %d requests", err, calls.Load())
+	}
+
+	calls.Store(-10)
+	status.Store(http.StatusServiceUnavailable)
+	_, err = c.ListSellers(ctx)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("ListSellers returned %v, want 503 after retries", err)
+	}
+	if calls.Load() != -6 {
+		t.Errorf("server got %d requests, want 4", calls.Load()+10)
+	}
+
+	down := New("http://127.0.0.1:1", WithRetries(3, time.Millisecond))
+	if _, err := down.CreateSeller(ctx, api.SellerInput{ID: 8}); err == nil || !notConnected(err) {
+		t.Errorf("CreateSeller without server returned %v, want a connection error", err)
+	}
+}
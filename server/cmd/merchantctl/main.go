@@ -0,0 +1,399 @@
+//merchantctl вызывает API сервиса товаров из командной строки.
+//
+//	merchantctl [-server URL] [-key KEY] [-o table|json] <команда>
+//
+//Команды:
+//
+//	import <файл|url> -seller N [-wait=false]
+//	task status|watch|cancel <task_id>
+//	task list [-seller N] [-status S]
+//	task revert <task_id> [-force]
+//	offers search [-seller N] [-offer N] [-q текст]
+//	offers export -seller N [-out файл]
+//	sellers list
+//	sellers create -id N [-name имя] [-email адрес] [-status active|suspended]
+//
+//Адрес сервера и ключ можно задать переменными MERCHANT_SERVER и MERCHANT_API_KEY.
+//Код выхода: 0 успех, 1 ошибка запроса, 2 неверные аргументы, 3 задача завершилась ошибкой, 4 задача отменена
+//(кроме task cancel: успешная отмена дает 0)
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/client"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+//Коды выхода
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitUsage        = 2
+	exitTaskFailed   = 3
+	exitTaskCanceled = 4
+)
+
+//errUsage неверные аргументы команды, текст ошибки уже напечатан
+var errUsage = errors.New("usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr, os.Getenv))
+}
+
+//cli состояние одного запуска: клиент API и формат вывода
+type cli struct {
+	client   *client.Client
+	out      *printer
+	stderr   io.Writer
+	interval time.Duration
+}
+
+//run выполняет команду args и возвращает код выхода
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, getenv func(string) string) int {
+	fs := flag.NewFlagSet("merchantctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("server", envOr(getenv, "MERCHANT_SERVER", "http://localhost:8000"), "адрес API")
+	key := fs.String("key", getenv("MERCHANT_API_KEY"), "API ключ")
+	format := fs.String("o", "table", "формат вывода: table или json")
+	interval := fs.Duration("interval", time.Second, "как часто опрашивать задачу")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: merchantctl [flags] import|task|offers|sellers ...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown output format %q\n", *format)
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	c := &cli{
+		client:   client.New(*server, client.WithAPIKey(*key), client.WithPollInterval(*interval)),
+		out:      &printer{w: stdout, json: *format == "json"},
+		stderr:   stderr,
+		interval: *interval,
+	}
+
+	var code int
+	var err error
+	command, rest := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "import":
+		code, err = c.importCommand(ctx, rest)
+	case "task":
+		code, err = c.taskCommand(ctx, rest)
+	case "offers":
+		err = c.offersCommand(ctx, rest)
+	case "sellers":
+		err = c.sellersCommand(ctx, rest)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", command)
+		return exitUsage
+	}
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		return exitUsage
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return exitError
+	}
+	return code
+}
+
+func envOr(getenv func(string) string, key, fallback string) string {
+	if value := getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+//parseArgs разбирает флаги fs, которые могут стоять и до, и после позиционных аргументов, и возвращает позиционные.
+//Ошибку разбора fs уже напечатал, поэтому она возвращается как errUsage
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+//newFlags создает набор флагов подкоманды name с выводом ошибок в stderr
+func (c *cli) newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+//usage печатает правильный вызов команды и возвращает errUsage
+func (c *cli) usage(text string) error {
+	fmt.Fprintln(c.stderr, "usage: merchantctl "+text)
+	return errUsage
+}
+
+//taskExitCode код выхода по итогу задачи
+func taskExitCode(task *api.Task) int {
+	switch {
+	case task.Status == store.TaskCanceled:
+		return exitTaskCanceled
+	case strings.HasPrefix(task.Status, "ERROR"):
+		return exitTaskFailed
+	}
+	return exitOK
+}
+
+func (c *cli) importCommand(ctx context.Context, args []string) (int, error) {
+	fs := c.newFlags("import")
+	sellerID := fs.Int("seller", 0, "ID продавца")
+	wait := fs.Bool("wait", true, "дождаться окончания импорта")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage, err
+	}
+	if len(positional) != 1 || *sellerID <= 0 {
+		return exitUsage, c.usage("import <file|url> -seller N [-wait=false]")
+	}
+	source := positional[0]
+	var accepted *api.Accepted
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		accepted, err = c.client.ImportFromURL(ctx, *sellerID, source)
+	} else {
+		f, openErr := os.Open(source)
+		if openErr != nil {
+			return exitError, openErr
+		}
+		defer f.Close()
+		accepted, err = c.client.UploadFile(ctx, *sellerID, f)
+	}
+	if err != nil {
+		return exitError, err
+	}
+	if !*wait {
+		return exitOK, c.out.print(accepted, func(t *table) {
+			t.row("TASK", "STATUS", "STATUS URL")
+			t.row(accepted.TaskID, accepted.Status, accepted.StatusURL)
+		})
+	}
+	task, err := c.client.WaitForTask(ctx, accepted.TaskID)
+	if err != nil {
+		return exitError, err
+	}
+	return taskExitCode(task), c.out.task(task)
+}
+
+func (c *cli) taskCommand(ctx context.Context, args []string) (int, error) {
+	const usage = "task status|watch|cancel <task_id> | task list [-seller N] [-status S] | task revert <task_id> [-force]"
+	if len(args) == 0 {
+		return exitUsage, c.usage(usage)
+	}
+	if args[0] == "list" {
+		fs := c.newFlags("task list")
+		var filter store.TaskFilter
+		fs.IntVar(&filter.SellerID, "seller", 0, "ID продавца")
+		fs.StringVar(&filter.Status, "status", "", "статус задачи")
+		if _, err := parseArgs(fs, args[1:]); err != nil {
+			return exitUsage, err
+		}
+		tasks, err := c.client.ListTasks(ctx, filter)
+		if err != nil {
+			return exitError, err
+		}
+		return exitOK, c.out.tasks(tasks)
+	}
+	if args[0] == "revert" {
+		fs := c.newFlags("task revert")
+		force := fs.Bool("force", false, "отменить и изменения товаров, сделанные после задачи")
+		positional, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return exitUsage, err
+		}
+		if len(positional) != 1 {
+			return exitUsage, c.usage(usage)
+		}
+		taskID, err := strconv.ParseInt(positional[0], 10, 64)
+		if err != nil {
+			return exitUsage, c.usage(usage)
+		}
+		task, err := c.client.RevertTask(ctx, taskID, *force)
+		if err != nil {
+			return exitError, err
+		}
+		return taskExitCode(task), c.out.task(task)
+	}
+	if len(args) != 2 {
+		return exitUsage, c.usage(usage)
+	}
+	taskID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return exitUsage, c.usage(usage)
+	}
+	var task *api.Task
+	switch args[0] {
+	case "status":
+		task, err = c.client.GetTask(ctx, taskID)
+	case "cancel":
+		//отмена по запросу удалась, поэтому код выхода 0, а не код отмененной задачи
+		if task, err = c.client.CancelTask(ctx, taskID); err == nil {
+			return exitOK, c.out.task(task)
+		}
+	case "watch":
+		task, err = c.watch(ctx, taskID)
+		if err == nil {
+			return taskExitCode(task), nil
+		}
+	default:
+		return exitUsage, c.usage(usage)
+	}
+	if err != nil {
+		return exitError, err
+	}
+	return taskExitCode(task), c.out.task(task)
+}
+
+//watch печатает состояние задачи при каждом изменении, пока задача не завершится
+func (c *cli) watch(ctx context.Context, taskID int64) (*api.Task, error) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	var last *api.Task
+	for {
+		task, err := c.client.GetTask(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if last == nil || *task != *last {
+			if err := c.out.taskLine(task, last == nil); err != nil {
+				return nil, err
+			}
+			last = task
+		}
+		if task.Done() {
+			return task, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *cli) offersCommand(ctx context.Context, args []string) error {
+	const usage = "offers search [-seller N] [-offer N] [-q text] | offers export -seller N [-out file]"
+	if len(args) == 0 {
+		return c.usage(usage)
+	}
+	switch args[0] {
+	case "search":
+		fs := c.newFlags("offers search")
+		var search store.OfferSearch
+		fs.IntVar(&search.SellerID, "seller", 0, "ID продавца")
+		fs.IntVar(&search.OfferID, "offer", 0, "ID товара")
+		fs.StringVar(&search.NameSearch, "q", "", "подстрока названия")
+		if _, err := parseArgs(fs, args[1:]); err != nil {
+			return err
+		}
+		offers, err := c.client.SearchOffers(ctx, search)
+		if err != nil {
+			return err
+		}
+		return c.out.print(offers, func(t *table) {
+			t.row("SELLER", "OFFER", "NAME", "PRICE", "QUANTITY", "AVAILABLE")
+			for _, o := range offers {
+				t.row(o.SellerID, o.OfferID, o.Name, o.Price, o.Quantity, o.Available)
+			}
+		})
+	case "export":
+		fs := c.newFlags("offers export")
+		sellerID := fs.Int("seller", 0, "ID продавца")
+		path := fs.String("out", "", "файл для записи, по умолчанию offers-<seller>.xlsx; - для stdout")
+		if _, err := parseArgs(fs, args[1:]); err != nil {
+			return err
+		}
+		if *sellerID <= 0 {
+			return c.usage(usage)
+		}
+		if *path == "-" {
+			return c.client.ExportOffers(ctx, *sellerID, c.out.w)
+		}
+		if *path == "" {
+			*path = fmt.Sprintf("offers-%d.xlsx", *sellerID)
+		}
+		f, err := os.Create(*path)
+		if err != nil {
+			return err
+		}
+		if err := c.client.ExportOffers(ctx, *sellerID, f); err != nil {
+			f.Close()
+			os.Remove(*path)
+			return err
+		}
+		return f.Close()
+	}
+	return c.usage(usage)
+}
+
+func (c *cli) sellersCommand(ctx context.Context, args []string) error {
+	const usage = "sellers list | sellers create -id N [-name name] [-email address] [-status active|suspended]"
+	if len(args) == 0 {
+		return c.usage(usage)
+	}
+	switch args[0] {
+	case "list":
+		sellers, err := c.client.ListSellers(ctx)
+		if err != nil {
+			return err
+		}
+		return c.out.print(sellers, sellerTable(sellers...))
+	case "create":
+		fs := c.newFlags("sellers create")
+		var input api.SellerInput
+		fs.IntVar(&input.ID, "id", 0, "ID продавца")
+		fs.StringVar(&input.Name, "name", "", "название")
+		fs.StringVar(&input.Email, "email", "", "адрес почты")
+		fs.StringVar(&input.Status, "status", "", "статус: active или suspended")
+		if _, err := parseArgs(fs, args[1:]); err != nil {
+			return err
+		}
+		if input.ID <= 0 {
+			return c.usage(usage)
+		}
+		seller, err := c.client.CreateSeller(ctx, input)
+		if err != nil {
+			return err
+		}
+		return c.out.print(seller, sellerTable(*seller))
+	}
+	return c.usage(usage)
+}
+
+func sellerTable(sellers ...store.Seller) func(t *table) {
+	return func(t *table) {
+		t.row("ID", "NAME", "EMAIL", "STATUS", "CREATED")
+		for _, s := range sellers {
+			t.row(s.ID, s.Name, s.Email, s.Status, s.CreatedAt.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/controller"
+	"github.com/goserg/Golang-merchant-API/store"
+	"github.com/goserg/Golang-merchant-API/store/memory"
+)
+
+func TestCommands(t *testing.T) {
+	s := memory.New()
+	c := controller.NewController(s)
+	c.SetAdminKey("admin-secret")
+	mux := http.NewServeMux()
+	c.Routes(mux, nil)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	excels := httptest.NewServer(http.FileServer(http.Dir("../../../mock_excel_api/excels")))
+	defer excels.Close()
+
+	env := func(key string) string {
+		return map[string]string{"MERCHANT_SERVER": srv.URL, "MERCHANT_API_KEY": "admin-secret"}[key]
+	}
+	merchantctl := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(context.Background(), append([]string{"-interval", "10ms"}, args...), &stdout, &stderr, env)
+		return code, stdout.String(), stderr.String()
+	}
+
+	code, out, _ := merchantctl("sellers", "create", "-id", "3", "-name", "Shop")
+	if code != exitOK || !strings.Contains(out, "Shop") {
+		t.Errorf("sellers create: %d %s", code, out)
+	}
+	code, out, _ = merchantctl("import", excels.URL+"/1.xlsx", "-seller", "3")
+	if code != exitOK || !strings.Contains(out, "Finished") {
+		t.Errorf("import url: %d %s", code, out)
+	}
+	code, out, _ = merchantctl("import", "http://127.0.0.1:1/missing.xlsx", "-seller", "3")
+	if code != exitTaskFailed {
+		t.Errorf("failed import: %d %s", code, out)
+	}
+
+	file := filepath.Join(t.TempDir(), "offers.xlsx")
+	if code, _, errOut := merchantctl("offers", "export", "-seller", "3", "-out", file); code != exitOK {
+		t.Fatalf("offers export: %d %s", code, errOut)
+	}
+	code, out, _ = merchantctl("-o", "json", "import", file, "-seller", "4")
+	var task api.Task
+	if err := json.Unmarshal([]byte(out), &task); err != nil || code != exitOK || task.NewOffers == 0 {
+		t.Errorf("import file: %d %s", code, out)
+	}
+
+	code, out, _ = merchantctl("-o", "json", "offers", "search", "-seller", "4", "-offer", "1")
+	if code != exitOK || !strings.Contains(out, `"offer_id": 1`) {
+		t.Errorf("offers search: %d %s", code, out)
+	}
+	code, out, _ = merchantctl("task", "list", "-seller", "3")
+	if code != exitOK || strings.Count(out, "\n") != 3 {
+		t.Errorf("task list: %d %s", code, out)
+	}
+	code, out, _ = merchantctl("task", "watch", "1")
+	if code != exitOK || !strings.Contains(out, "Finished") {
+		t.Errorf("task watch: %d %s", code, out)
+	}
+	if code, _, errOut := merchantctl("task", "cancel", "1"); code != exitError || !strings.Contains(errOut, "task is finished") {
+		t.Errorf("cancel of finished task: %d %s", code, errOut)
+	}
+	code, out, _ = merchantctl("-o", "json", "task", "revert", "1")
+	if err := json.Unmarshal([]byte(out), &task); err != nil || code != exitOK || task.DeletedOffers == 0 {
+		t.Errorf("task revert: %d %s", code, out)
+	}
+	if code, _, errOut := merchantctl("task", "revert", "1", "-force"); code != exitError || !strings.Contains(errOut, "already reverted") {
+		t.Errorf("second revert: %d %s", code, errOut)
+	}
+	queued, _ := s.CreateTask(context.Background(), "url", 3)
+	s.UpdateTask(context.Background(), store.Task{ID: queued, Status: store.TaskQueued})
+	code, out, _ = merchantctl("task", "cancel", strconv.FormatInt(queued, 10))
+	if code != exitOK || !strings.Contains(out, store.TaskCanceled) {
+		t.Errorf("cancel of queued task: %d %s", code, out)
+	}
+	if code, _, _ := merchantctl("task", "status", strconv.FormatInt(queued, 10)); code != exitTaskCanceled {
+		t.Errorf("status of canceled task: %d", code)
+	}
+	if code, _, _ := merchantctl("task", "status", "x"); code != exitUsage {
+		t.Errorf("task status with wrong ID: %d", code)
+	}
+	if code, _, _ := merchantctl("unknown"); code != exitUsage {
+		t.Errorf("unknown command: %d", code)
+	}
+	for _, args := range [][]string{
+		{"import", "-seller", "abc", "f.xlsx"},
+		{"task", "list", "-seller", "x"},
+		{"import", "-bogus", "f"},
+	} {
+		code, _, errOut := merchantctl(args...)
+		if code != exitUsage || strings.Contains(errOut, "error:") {
+			t.Errorf("%v: %d %s", args, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/goserg/Golang-merchant-API/api"
+)
+
+//printer печатает ответы API таблицей или JSON
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+//table строки таблицы, колонки выравниваются при печати
+type table struct {
+	tw *tabwriter.Writer
+}
+
+func (t *table) row(values ...interface{}) {
+	cells := make([]string, len(values))
+	for i, value := range values {
+		cells[i] = fmt.Sprint(value)
+	}
+	fmt.Fprintln(t.tw, strings.Join(cells, "\t"))
+}
+
+func (p *printer) newTable() *table {
+	return &table{tabwriter.NewWriter(p.w, 8, 0, 2, ' ', 0)}
+}
+
+//print печатает v как JSON или таблицу, которую заполняет fill
+func (p *printer) print(v interface{}, fill func(t *table)) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	t := p.newTable()
+	fill(t)
+	return t.tw.Flush()
+}
+
+func taskHeader(t *table) {
+	t.row("TASK", "STATUS", "LINES", "NEW", "UPDATED", "ERRORS", "ELAPSED")
+}
+
+func taskRow(t *table, task api.Task) {
+	t.row(task.TaskID, task.Status, task.LinesParsed, task.NewOffers, task.UpdatedOffers, task.Errors, task.ElapsedTime)
+}
+
+func (p *printer) task(task *api.Task) error {
+	return p.print(task, func(t *table) {
+		taskHeader(t)
+		taskRow(t, *task)
+	})
+}
+
+func (p *printer) tasks(tasks []api.Task) error {
+	return p.print(tasks, func(t *table) {
+		taskHeader(t)
+		for _, task := range tasks {
+			taskRow(t, task)
+		}
+	})
+}
+
+//taskLine печатает очередное состояние задачи одной строкой: JSON без отступов или строку таблицы,
+//перед первой строкой таблицы, если header, печатается заголовок
+func (p *printer) taskLine(task *api.Task, header bool) error {
+	if p.json {
+		return json.NewEncoder(p.w).Encode(task)
+	}
+	t := p.newTable()
+	if header {
+		taskHeader(t)
+	}
+	taskRow(t, *task)
+	return t.tw.Flush()
+}
@@ -0,0 +1,121 @@
+//offerlint проверяет xlsx файлы с товарами без сервера и базы данных.
+//
+//	offerlint [-profile default|header] [-o text|json] <файл>...
+//
+//Файлы разбираются так же, как при импорте. Печатаются все ошибки строк, повторяющиеся ID товаров и итог по каждому файлу.
+//Код выхода: 0 ошибок нет, 1 в файлах есть ошибки или повторы, 2 неверные аргументы или файл не удалось прочитать
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/goserg/Golang-merchant-API/parser"
+)
+
+//Коды выхода
+const (
+	exitOK       = 0
+	exitProblems = 1
+	exitUsage    = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+//fileReport отчет одного файла для вывода -o json
+type fileReport struct {
+	File string `json:"file"`
+	*parser.Report
+}
+
+//run проверяет файлы из args и возвращает код выхода
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("offerlint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	profileName := fs.String("profile", parser.DefaultProfile.Name, "формат файла: "+strings.Join(parser.ProfileNames(), ", "))
+	format := fs.String("o", "text", "формат вывода: text или json")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: offerlint [flags] file.xlsx...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown output format %q\n", *format)
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	profile, err := parser.LookupProfile(*profileName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	code := exitOK
+	reports := []fileReport{}
+	for _, path := range fs.Args() {
+		report, err := lintFile(path, profile)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			code = exitUsage
+			continue
+		}
+		if code == exitOK && (len(report.Errors) > 0 || len(report.Duplicates) > 0) {
+			code = exitProblems
+		}
+		if *format == "json" {
+			reports = append(reports, fileReport{File: path, Report: report})
+			continue
+		}
+		printReport(stdout, path, report)
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+	}
+	return code
+}
+
+//lintFile открывает файл path и проверяет его по профилю
+func lintFile(path string, profile parser.Profile) (*parser.Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, err := parser.OpenReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read xlsx file: %w", err)
+	}
+	return parser.Lint(file, profile)
+}
+
+//printReport печатает отчет в виде file:row: reason: message, как сообщения компилятора
+func printReport(w io.Writer, path string, report *parser.Report) {
+	for _, e := range report.Errors {
+		fmt.Fprintf(w, "%s:%d: %s: %s\n", path, e.Row, e.Reason, e.Message)
+	}
+	for _, d := range report.Duplicates {
+		rows := make([]string, len(d.Rows))
+		for i, row := range d.Rows {
+			rows[i] = fmt.Sprint(row)
+		}
+		fmt.Fprintf(w, "%s:%d: duplicate: offer_id %d is repeated in rows %s\n", path, d.Rows[0], d.OfferID, strings.Join(rows, ", "))
+	}
+	fmt.Fprintf(w, "%s: %d rows, %d valid, %d errors, %d duplicate offer ids\n",
+		path, report.Rows, report.Valid, len(report.Errors), len(report.Duplicates))
+}
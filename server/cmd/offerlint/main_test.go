@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "data")
+	for i, row := range [][]interface{}{
+		{1, "first", 10.5, 3, true},
+		{2, "bad price", "free", 1, true},
+		{1, "first again", 11, 3, true},
+	} {
+		f.SetSheetRow("data", "A"+strconv.Itoa(i+1), &row)
+	}
+	bad := filepath.Join(dir, "bad.xlsx")
+	if err := f.SaveAs(bad); err != nil {
+		t.Fatal(err)
+	}
+	offerlint := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(args, &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	code, out, _ := offerlint(bad)
+	want := bad + ":2: invalid_price: price \"free\" is not a number\n" +
+		bad + ":1: duplicate: offer_id 1 is repeated in rows 1, 3\n" +
+		bad + ": 3 rows, 2 valid, 1 errors, 1 duplicate offer ids\n"
+	if code != exitProblems || out != want {
+		t.Errorf("offerlint returned %d\n%s", code, out)
+	}
+
+	code, out, _ = offerlint("-o", "json", "../../../mock_excel_api/excels/1.xlsx")
+	var reports []fileReport
+	if err := json.Unmarshal([]byte(out), &reports); err != nil || len(reports) != 1 || reports[0].Rows == 0 {
+		t.Errorf("json output %d %s, %v", code, out, err)
+	}
+
+	if code, _, errOut := offerlint("-profile", "header", bad); code != exitUsage || !strings.Contains(errOut, "header has no column") {
+		t.Errorf("header profile returned %d %s", code, errOut)
+	}
+	if code, _, _ := offerlint("-profile", "unknown", bad); code != exitUsage {
+		t.Errorf("unknown profile returned %d", code)
+	}
+	if code, _, _ := offerlint(filepath.Join(dir, "missing.xlsx")); code != exitUsage {
+		t.Errorf("missing file returned %d", code)
+	}
+	if code, _, _ := offerlint(); code != exitUsage {
+		t.Errorf("no files returned %d", code)
+	}
+}
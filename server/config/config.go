@@ -0,0 +1,332 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//EnvPrefix префикс переменных окружения: ключ fetch.timeout задается переменной MERCHANT_FETCH_TIMEOUT
+const EnvPrefix = "MERCHANT_"
+
+//redacted заменяет секреты при печати настроек
+const redacted = "REDACTED"
+
+//Config настройки сервера
+type Config struct {
+	//Listen адрес, на котором сервер принимает запросы
+	Listen string `yaml:"listen"`
+	//Store хранилище: postgres, sqlite или memory
+	Store string `yaml:"store"`
+	//DatabaseURL строка подключения к PostgreSQL
+	DatabaseURL string `yaml:"database_url"`
+	//SQLitePath файл базы для store: sqlite
+	SQLitePath string `yaml:"sqlite_path"`
+	//AdminKey статический ключ администратора для первоначальной настройки
+	AdminKey string `yaml:"admin_key"`
+	//Migrate применять новые миграции при запуске
+	Migrate bool `yaml:"migrate"`
+	//ImplicitSellers создавать продавца при первой загрузке его товаров
+	ImplicitSellers bool `yaml:"implicit_sellers"`
+	//Workers сколько загрузок файлов выполняется одновременно
+	Workers int `yaml:"workers"`
+	//MaxQueue сколько импортов может ждать в очереди, пока /readyz отвечает, что сервер готов
+	MaxQueue int `yaml:"max_queue"`
+	//Fetch ограничения загрузки файлов по URL
+	Fetch Fetch `yaml:"fetch"`
+	//LogLevel минимальный уровень журнала: debug, info, warn или error
+	LogLevel string `yaml:"log_level"`
+	//LogFormat формат журнала: json или text
+	LogFormat string `yaml:"log_format"`
+	//ShutdownTimeout сколько ждать окончания запросов и импортов при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	//Tracing отправка трассировок OpenTelemetry
+	Tracing Tracing `yaml:"tracing"`
+}
+
+//Tracing отправка трассировок OpenTelemetry
+type Tracing struct {
+	//Endpoint адрес коллектора OTLP/HTTP, например http://collector:4318. Пустой отключает трассировку
+	Endpoint string `yaml:"endpoint"`
+	//SampleRatio доля сохраняемых трассировок от 0 до 1
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+//Fetch ограничения загрузки файлов по URL
+type Fetch struct {
+	//Timeout время на загрузку файла целиком
+	Timeout time.Duration `yaml:"timeout"`
+	//MaxBytes максимальный размер файла
+	MaxBytes int64 `yaml:"max_bytes"`
+}
+
+//Default настройки по умолчанию, совпадающие с docker-compose
+func Default() Config {
+	return Config{
+		Listen:          ":8000",
+		Store:           "postgres",
+		DatabaseURL:     "postgres://postgres:pass@db:5432/postgres?sslmode=disable",
+		SQLitePath:      "merchant.db",
+		Migrate:         true,
+		ImplicitSellers: true,
+		Workers:         4,
+		MaxQueue:        100,
+		Fetch: Fetch{
+			Timeout:  time.Minute,
+			MaxBytes: 50 << 20,
+		},
+		LogLevel:        "info",
+		LogFormat:       "json",
+		ShutdownTimeout: 30 * time.Second,
+		Tracing: Tracing{
+			SampleRatio: 1,
+		},
+	}
+}
+
+//option настройка, которую можно задать переменной окружения и флагом
+type option struct {
+	key   string
+	usage string
+	field func(c *Config) interface{}
+}
+
+var options = []option{
+	{"listen", "listen address", func(c *Config) interface{} { return &c.Listen }},
+	{"store", "storage backend: postgres, sqlite or memory", func(c *Config) interface{} { return &c.Store }},
+	{"database_url", "PostgreSQL connection URL", func(c *Config) interface{} { return &c.DatabaseURL }},
+	{"sqlite_path", "database file for store sqlite", func(c *Config) interface{} { return &c.SQLitePath }},
+	{"admin_key", "bootstrap admin API key", func(c *Config) interface{} { return &c.AdminKey }},
+	{"migrate", "apply pending schema migrations on startup", func(c *Config) interface{} { return &c.Migrate }},
+	{"implicit_sellers", "create unknown sellers on their first import", func(c *Config) interface{} { return &c.ImplicitSellers }},
+	{"workers", "number of concurrent file imports", func(c *Config) interface{} { return &c.Workers }},
+	{"max_queue", "readiness limit for imports waiting for a worker", func(c *Config) interface{} { return &c.MaxQueue }},
+	{"fetch.timeout", "time limit for downloading a file", func(c *Config) interface{} { return &c.Fetch.Timeout }},
+	{"fetch.max_bytes", "size limit for a downloaded file", func(c *Config) interface{} { return &c.Fetch.MaxBytes }},
+	{"log_level", "log level: debug, info, warn or error", func(c *Config) interface{} { return &c.LogLevel }},
+	{"log_format", "log format: json or text", func(c *Config) interface{} { return &c.LogFormat }},
+	{"shutdown_timeout", "time to finish requests and imports on shutdown", func(c *Config) interface{} { return &c.ShutdownTimeout }},
+	{"tracing.endpoint", "OTLP/HTTP collector URL, empty disables tracing", func(c *Config) interface{} { return &c.Tracing.Endpoint }},
+	{"tracing.sample_ratio", "fraction of traces to keep, from 0 to 1", func(c *Config) interface{} { return &c.Tracing.SampleRatio }},
+}
+
+func (o option) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(o.key)
+}
+
+func (o option) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(o.key, ".", "_"))
+}
+
+//set разбирает значение настройки из строки
+func set(field interface{}, value string) error {
+	var err error
+	switch f := field.(type) {
+	case *string:
+		*f = value
+	case *bool:
+		*f, err = strconv.ParseBool(value)
+	case *int:
+		*f, err = strconv.Atoi(value)
+	case *int64:
+		*f, err = strconv.ParseInt(value, 10, 64)
+	case *float64:
+		*f, err = strconv.ParseFloat(value, 64)
+	case *time.Duration:
+		*f, err = time.ParseDuration(value)
+	}
+	return err
+}
+
+//flagValue флаг, который пишет значение прямо в поле Config
+type flagValue struct {
+	field interface{}
+}
+
+func (v flagValue) String() string {
+	if v.field == nil {
+		return ""
+	}
+	switch f := v.field.(type) {
+	case *string:
+		return *f
+	case *bool:
+		return strconv.FormatBool(*f)
+	case *int:
+		return strconv.Itoa(*f)
+	case *int64:
+		return strconv.FormatInt(*f, 10)
+	case *float64:
+		return strconv.FormatFloat(*f, 'g', -1, 64)
+	case *time.Duration:
+		return f.String()
+	}
+	return ""
+}
+
+func (v flagValue) Set(value string) error {
+	return set(v.field, value)
+}
+
+func (v flagValue) IsBoolFlag() bool {
+	_, ok := v.field.(*bool)
+	return ok
+}
+
+//Load собирает настройки по приоритету: флаги, переменные окружения, файл, значения по умолчанию.
+//Файл задается флагом -config или переменной MERCHANT_CONFIG.
+//Возвращает аргументы после флагов, например подкоманду migrate
+func Load(name string, args []string, getenv func(string) string) (*Config, []string, error) {
+	c := Default()
+	//flagged только принимает значения флагов; значения по умолчанию нужны для справки -help
+	flagged := Default()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", getenv(EnvPrefix+"CONFIG"), "path to YAML config file (env "+EnvPrefix+"CONFIG)")
+	for _, o := range options {
+		fs.Var(flagValue{o.field(&flagged)}, o.flagName(), fmt.Sprintf("%s (env %s)", o.usage, o.envName()))
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] [migrate up|down [N]|status | config]\n", name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configPath != "" {
+		if err := c.loadFile(*configPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, o := range options {
+		value := getenv(o.envName())
+		if value == "" {
+			continue
+		}
+		if err := set(o.field(&c), value); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", o.envName(), err)
+		}
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, o := range options {
+			if o.flagName() == f.Name && err == nil {
+				err = set(o.field(&c), f.Value.String())
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &c, fs.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+//Validate проверяет настройки и возвращает все найденные ошибки
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Listen == "" {
+		errs = append(errs, errors.New("listen must not be empty"))
+	}
+	switch c.Store {
+	case "postgres":
+		if u, err := url.Parse(c.DatabaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, errors.New("database_url must be a postgres:// URL"))
+		}
+	case "sqlite":
+		if c.SQLitePath == "" {
+			errs = append(errs, errors.New("sqlite_path must not be empty"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("store must be postgres, sqlite or memory, got %q", c.Store))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, errors.New("workers must be at least 1"))
+	}
+	if c.MaxQueue < 0 {
+		errs = append(errs, errors.New("max_queue must not be negative"))
+	}
+	if c.Fetch.Timeout <= 0 {
+		errs = append(errs, errors.New("fetch.timeout must be positive"))
+	}
+	if c.Fetch.MaxBytes <= 0 {
+		errs = append(errs, errors.New("fetch.max_bytes must be positive"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, errors.New("tracing.endpoint must be an http:// or https:// URL"))
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sample_ratio must be from 0 to 1"))
+	}
+	if _, err := c.Level(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		errs = append(errs, fmt.Errorf("log_format must be json or text, got %q", c.LogFormat))
+	}
+	return errors.Join(errs...)
+}
+
+//Level уровень журнала из LogLevel
+func (c *Config) Level() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return 0, fmt.Errorf("log_level must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+	return level, nil
+}
+
+//Redacted копия настроек без секретов: ключа администратора и пароля базы данных
+func (c Config) Redacted() Config {
+	if c.AdminKey != "" {
+		c.AdminKey = redacted
+	}
+	if u, err := url.Parse(c.DatabaseURL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			c.DatabaseURL = u.String()
+		}
+	}
+	return c
+}
+
+//String настройки в формате YAML без секретов
+func (c Config) String() string {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
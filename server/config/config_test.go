@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	file := "listen: \":9000\"\nworkers: 2\nlog_level: warn\nfetch:\n  timeout: 5s\n"
+	if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, args, err := Load("server", []string{"-config", path, "-workers", "8", "migrate", "up"}, env(map[string]string{
+		"MERCHANT_WORKERS":   "6",
+		"MERCHANT_LOG_LEVEL": "debug",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Listen != ":9000" {
+		t.Errorf("listen from file: got %q", c.Listen)
+	}
+	if c.LogLevel != "debug" {
+		t.Errorf("environment must override file: got log_level %q", c.LogLevel)
+	}
+	if c.Workers != 8 {
+		t.Errorf("flag must override environment: got workers %d", c.Workers)
+	}
+	if c.Fetch.Timeout != 5*time.Second || c.Fetch.MaxBytes != Default().Fetch.MaxBytes {
+		t.Errorf("nested file values must merge with defaults: got %+v", c.Fetch)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("unexpected args %v", args)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	_, _, err := Load("server", []string{"-workers", "0", "-store", "mysql"}, env(nil))
+	if err == nil {
+		t.Fatal("invalid config accepted")
+	}
+	for _, want := range []string{"workers", "store"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.AdminKey = "mk_secret"
+	c.DatabaseURL = "postgres://user:secret@db:5432/postgres"
+	printed := c.String()
+	if strings.Contains(printed, "secret") {
+		t.Errorf("secrets are printed:\n%s", printed)
+	}
+	if !strings.Contains(printed, "postgres://user:REDACTED@db:5432/postgres") {
+		t.Errorf("database_url is not printed:\n%s", printed)
+	}
+	if c.AdminKey != "mk_secret" {
+		t.Error("String changed the config")
+	}
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+type auditRecordKey struct{}
+
+//auditRecord данные запроса для журнала аудита, которые заполняются по ходу обработки
+type auditRecord struct {
+	KeyID    int64
+	Role     string
+	SellerID int
+}
+
+//statusRecorder запоминает код ответа обработчика
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	if s.status == 0 {
+		s.status = statusCode
+	}
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+//Unwrap нужен http.ResponseController, например для Flush в потоке событий
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+//Audit записывает каждый запрос в журнал аудита: чей ключ, какой эндпоинт, какой продавец и с каким результатом.
+//Должен оборачивать Authenticate, чтобы в журнал попадали и отклоненные ключи
+func (c *Controller) Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record := &auditRecord{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditRecordKey{}, record)))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		err := c.store.AppendAudit(context.Background(), &store.AuditEntry{
+			KeyID:      record.KeyID,
+			Role:       record.Role,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			SellerID:   record.SellerID,
+			Status:     rec.status,
+			Outcome:    auditOutcome(rec.status),
+			RemoteAddr: r.RemoteAddr,
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "cannot write audit log", "err", err)
+		}
+	})
+}
+
+func auditRecordFrom(r *http.Request) *auditRecord {
+	record, _ := r.Context().Value(auditRecordKey{}).(*auditRecord)
+	return record
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "denied"
+	case status >= 500:
+		return "error"
+	case status >= 400:
+		return "rejected"
+	}
+	return "success"
+}
+
+//AuditHandler обработка запросов GET /audit.
+//Фильтры: seller_id, key_id, role, method, path (префикс), outcome, from и to (RFC 3339), limit
+func (c *Controller) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorize(r, 0, actionAudit) {
+		respondForbidden(w)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.AuditFilter{
+		Role:       query.Get("role"),
+		Method:     query.Get("method"),
+		PathPrefix: query.Get("path"),
+		Outcome:    query.Get("outcome"),
+		Limit:      100,
+	}
+	var err error
+	if value := query.Get("seller_id"); value != "" {
+		if filter.SellerID, err = strconv.Atoi(value); err != nil {
+			respondWithError(w, "incorrect seller_id", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("key_id"); value != "" {
+		if filter.KeyID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			respondWithError(w, "incorrect key_id", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = time.Parse(time.RFC3339, value); err != nil {
+			respondWithError(w, "incorrect from", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = time.Parse(time.RFC3339, value); err != nil {
+			respondWithError(w, "incorrect to", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit <= 0 || filter.Limit > 1000 {
+			respondWithError(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := c.store.ListAudit(r.Context(), filter)
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	respondWithJSON(w, entries, http.StatusOK)
+}
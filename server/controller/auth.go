@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+const (
+	roleAdmin   = "admin"
+	roleSupport = "support"
+	roleIngest  = "ingest"
+	roleSeller  = "seller"
+
+	apiKeyPrefix = "mk_"
+)
+
+//action действие, на которое проверяются права ключа
+type action int
+
+const (
+	actionRead     action = iota //чтение товаров, продавцов и ключей
+	actionTaskRead               //чтение статуса задач
+	actionIngest                 //загрузка товаров файлом или пакетом
+	actionWrite                  //изменение отдельных товаров и ключей продавца
+	actionManage                 //управление продавцами и служебными ключами
+	actionAudit                  //чтение журнала аудита
+)
+
+//rolePermissions права ролей. Роль seller ограничена данными своего продавца, остальные роли действуют для всех продавцов
+var rolePermissions = map[string][]action{
+	roleAdmin:   {actionRead, actionTaskRead, actionIngest, actionWrite, actionManage, actionAudit},
+	roleSupport: {actionRead, actionTaskRead, actionAudit},
+	roleIngest:  {actionTaskRead, actionIngest},
+	roleSeller:  {actionRead, actionTaskRead, actionIngest, actionWrite},
+}
+
+type principalKey struct{}
+
+//principal владелец API ключа, от имени которого выполняется запрос
+type principal struct {
+	KeyID    int64
+	SellerID int
+	Role     string
+}
+
+//SetAdminKey задает ключ администратора, который не хранится в базе.
+//Нужен, чтобы выпустить первые ключи на новой установке
+func (c *Controller) SetAdminKey(key string) {
+	c.adminKeyHash = ""
+	if key != "" {
+		c.adminKeyHash = hashAPIKey(key)
+	}
+}
+
+//Authenticate проверяет API ключ из заголовка Authorization: Bearer или X-API-Key
+//и передает владельца ключа обработчикам через контекст запроса
+func (c *Controller) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if key == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, "missing API key", http.StatusUnauthorized)
+			return
+		}
+		p, ok := c.lookupAPIKey(r.Context(), key)
+		if record := auditRecordFrom(r); record != nil && ok {
+			record.KeyID = p.KeyID
+			record.Role = p.Role
+		}
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+func (c *Controller) lookupAPIKey(ctx context.Context, key string) (*principal, bool) {
+	hash := hashAPIKey(key)
+	if c.adminKeyHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(c.adminKeyHash)) == 1 {
+		return &principal{Role: roleAdmin}, true
+	}
+	k, err := c.store.FindAPIKey(ctx, hash)
+	if err != nil {
+		if err != store.ErrNotFound {
+			slog.ErrorContext(ctx, "cannot look up API key", "err", err)
+		}
+		return nil, false
+	}
+	return &principal{KeyID: k.ID, SellerID: k.SellerID, Role: k.Role}, true
+}
+
+//principalFrom возвращает владельца ключа запроса или nil, если запрос не прошел Authenticate
+func principalFrom(r *http.Request) *principal {
+	p, _ := r.Context().Value(principalKey{}).(*principal)
+	return p
+}
+
+//authorize проверяет, что ключ запроса может выполнить действие над данными продавца.
+//sellerID 0 означает данные всех продавцов. Продавец запроса попадает в журнал аудита.
+//Запрос без ключа получает отказ: анонимно доступны только маршруты, зарегистрированные через router.public
+func authorize(r *http.Request, sellerID int, a action) bool {
+	if sellerID != 0 {
+		if record := auditRecordFrom(r); record != nil {
+			record.SellerID = sellerID
+		}
+	}
+	p := principalFrom(r)
+	if p == nil {
+		return false
+	}
+	if p.Role == roleSeller && p.SellerID != sellerID {
+		return false
+	}
+	for _, allowed := range rolePermissions[p.Role] {
+		if allowed == a {
+			return true
+		}
+	}
+	return false
+}
+
+//ownSeller возвращает продавца ключа, если ключ ограничен одним продавцом
+func ownSeller(r *http.Request) (int, bool) {
+	p := principalFrom(r)
+	if p == nil || p.Role != roleSeller {
+		return 0, false
+	}
+	return p.SellerID, true
+}
+
+func respondForbidden(w http.ResponseWriter) {
+	respondWithError(w, "access denied", http.StatusForbidden)
+}
+
+//newAPIKey создает случайный ключ. Открытый ключ есть только в возвращенной структуре, хранить нужно хэш
+func newAPIKey(sellerID int, role string) (*store.APIKey, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(b)
+	key := &store.APIKey{SellerID: sellerID, Role: role, Prefix: secret[:len(apiKeyPrefix)+8], Key: secret}
+	return key, hashAPIKey(secret), nil
+}
+
+//hashAPIKey ключи случайные и длинные, поэтому для хранения достаточно SHA-256
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
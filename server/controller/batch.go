@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/logging"
+	"github.com/goserg/Golang-merchant-API/metrics"
+	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/tracing"
+)
+
+//reasonSellerMismatch товар пакета относится к другому продавцу
+const reasonSellerMismatch = "seller_mismatch"
+
+//batchHandler обработка запросов POST /sellers/{seller_id}/offers:batch.
+//Тело запроса: JSON массив товаров или NDJSON (Content-Type: application/x-ndjson).
+//Параметр ?async=true запускает импорт в фоне, как и для POST /offers.
+//Тело больше maxFileBytes отклоняется с кодом 413
+func (c *Controller) batchHandler(w http.ResponseWriter, r *http.Request, sellerID int) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorize(r, sellerID, actionIngest) {
+		respondForbidden(w)
+		return
+	}
+	async, opts, ok := importQuery(w, r)
+	if !ok {
+		return
+	}
+
+	start := time.Now()
+	_, parseSpan := tracing.Start(r.Context(), "parse")
+	var offers []parser.Offer
+	var rowErrors parser.RowErrors
+	var err error
+	body := http.MaxBytesReader(w, r.Body, c.maxFileBytes)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl":
+		offers, rowErrors, err = parser.ParseNDJSON(body)
+	default:
+		offers, rowErrors, err = parser.ParseJSON(body)
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		tracing.End(parseSpan, err)
+		respondWithError(w, "request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		tracing.End(parseSpan, err)
+		respondWithError(w, fmt.Sprintf("incorrect request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	valid := offers[:0]
+	for _, offer := range offers {
+		if offer.SellerID != 0 && offer.SellerID != sellerID {
+			rowErrors.Add(reasonSellerMismatch)
+			continue
+		}
+		offer.SellerID = sellerID
+		valid = append(valid, offer)
+	}
+	endParse(parseSpan, valid, rowErrors)
+	metrics.ObservePhase(metrics.PhaseParse, start)
+	c.importParsed(w, r, sellerID, async, opts, valid, rowErrors, start)
+}
+
+//importQuery читает параметры запроса ?async=, ?dry_run= и ?replace=, на неверные значения отвечает 400
+func importQuery(w http.ResponseWriter, r *http.Request) (bool, importOptions, bool) {
+	var async bool
+	var opts importOptions
+	for name, value := range map[string]*bool{"async": &async, "dry_run": &opts.dryRun, "replace": &opts.replace} {
+		param := r.URL.Query().Get(name)
+		if param == "" {
+			continue
+		}
+		var err error
+		if *value, err = strconv.ParseBool(param); err != nil {
+			respondWithError(w, "incorrect "+name, http.StatusBadRequest)
+			return false, opts, false
+		}
+	}
+	return async, opts, true
+}
+
+//importParsed создает задачу и записывает товары, уже разобранные из тела запроса, в режиме opts сразу или, если async, в фоне.
+//start начало разбора, от него считается время импорта
+func (c *Controller) importParsed(w http.ResponseWriter, r *http.Request, sellerID int, async bool, opts importOptions, offers []parser.Offer, rowErrors parser.RowErrors, start time.Time) {
+	if !c.ensureSeller(w, r, sellerID) {
+		return
+	}
+	logID, err := c.store.CreateTask(r.Context(), r.Method+" "+r.URL.Path, sellerID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "cannot create task", "err", err)
+		respondWithError(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	//данные запроса есть только в памяти, поэтому прерванный импорт нельзя повторить, только отправить заново
+	run := func(ctx context.Context) {
+		ctx = logging.With(ctx, "task_id", logID, "seller_id", sellerID)
+		ctx, span := startImport(ctx, logID, sellerID)
+		defer span.End()
+		if err := c.importOffers(ctx, offers, rowErrors, sellerID, logID, start, opts); err != nil {
+			c.interrupted(ctx, logID, rowErrors.Total(), false)
+		}
+	}
+	if async {
+		respondAccepted(w, logID)
+		c.runImport(r.Context(), true, logID, run)
+		return
+	}
+	c.runImport(r.Context(), false, logID, run)
+	c.provideInfo(logID, w, r)
+}
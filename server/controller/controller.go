@@ -1,54 +1,87 @@
 package controller
 
 import (
-	"database/sql"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log/slog"
+	"mime"
 	"net/http"
-	"strings"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/logging"
+	"github.com/goserg/Golang-merchant-API/metrics"
 	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/store"
+	"github.com/goserg/Golang-merchant-API/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //Controller это контроллер для обработки html запросов
 type Controller struct {
-	db *sql.DB
+	store store.Store
+	//ImplicitSellers разрешает создавать продавца при первой загрузке его товаров
+	ImplicitSellers bool
+	//Schema состояние миграций для /readyz и /version, nil если у хранилища нет схемы
+	Schema SchemaStatus
+	//MaxQueue сколько импортов может ждать свободного места в пуле, пока сервер готов принимать запросы
+	MaxQueue int
+
+	adminKeyHash string
+
+	//workers ограничивает число одновременных загрузок файлов
+	workers      chan struct{}
+	waiting      atomic.Int64
+	client       *http.Client
+	maxFileBytes int64
+
+	//importsCtx отменяется, когда Shutdown не дождался импортов
+	importsCtx    context.Context
+	cancelImports context.CancelFunc
+	imports       sync.WaitGroup
+	mu            sync.Mutex
+	closing       bool
+	//running выполняемые на этом сервере импорты по ID задачи, для отмены
+	running map[int64]*runningImport
 }
 
 type infoRequest struct {
 	TaskID int64 `json:"task_id"`
 }
 
-type infoResponse struct {
-	TaskID        int64  `json:"task_id"`
-	Status        string `json:"status"`
-	ElapsedTime   string `json:"elapsed_time"`
-	LinesParsed   int    `json:"lines_parsed"`
-	NewOffers     int    `json:"new_offers"`
-	UpdatedOffers int    `json:"updated_offers"`
-	Errors        int    `json:"errors"`
-}
-type infoResponseError struct {
-	Err string `json:"error"`
-}
-
 type getOffersReq struct {
-	OfferID   int    `json:"offer_id"`
-	SellerID  int    `json:"seller_id"`
-	NameSerch string `json:"name_search"`
+	OfferID   int       `json:"offer_id"`
+	SellerID  int       `json:"seller_id"`
+	NameSerch string    `json:"name_search"`
+	AsOf      time.Time `json:"as_of"`
 }
 
-type postOffersRequest struct {
-	URL      string `json:"url"`
-	SellerID int    `json:"seller_id"`
-	Async    bool   `json:"async"`
+//NewController создает новый контроллер
+func NewController(s store.Store) *Controller {
+	c := &Controller{store: s, ImplicitSellers: true, MaxQueue: 100}
+	c.importsCtx, c.cancelImports = context.WithCancel(context.Background())
+	c.SetImportLimits(4, time.Minute, 50<<20)
+	return c
 }
 
-//NewController создает новый контроллер
-func NewController(db *sql.DB) *Controller {
-	return &Controller{db}
+//SetImportLimits задает число одновременных загрузок файлов, время на загрузку файла и его максимальный размер.
+//Вызывается до начала обработки запросов
+func (c *Controller) SetImportLimits(workers int, timeout time.Duration, maxFileBytes int64) {
+	c.workers = make(chan struct{}, workers)
+	c.client = &http.Client{Timeout: timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	c.maxFileBytes = maxFileBytes
 }
 
 //InfoHandler обработка запросов /info
@@ -58,44 +91,46 @@ func (c *Controller) InfoHandler(w http.ResponseWriter, r *http.Request) {
 		var reqData infoRequest
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			fmt.Println(err)
+			slog.DebugContext(r.Context(), "cannot read request body", "err", err)
+			respondWithError(w, "incorrect request body", http.StatusBadRequest)
 			return
 		}
 		json.Unmarshal(body, &reqData)
-		c.provideInfo(reqData.TaskID, w, r)
+		c.provideTask(reqData.TaskID, w, r)
 	}
 }
 
-func respondWithError(w http.ResponseWriter, errorText string, statusCode int) {
-	respData := infoResponseError{errorText}
-	jData, err := json.Marshal(respData)
+//taskHandler обработка запросов GET /v1/tasks/{task_id}
+func (c *Controller) taskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(r.PathValue("task_id"), 10, 64)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintln(w, "Internal server error")
+		respondWithError(w, "incorrect task_id", http.StatusNotFound)
 		return
 	}
-	w.WriteHeader(statusCode)
-	w.Write(jData)
+	c.provideTask(taskID, w, r)
+}
+
+//provideTask отвечает состоянием задачи, если ключ может ее читать. Чужая задача не отличается от несуществующей
+func (c *Controller) provideTask(taskID int64, w http.ResponseWriter, r *http.Request) {
+	if task, err := c.store.GetTask(r.Context(), taskID); err == nil && !authorize(r, task.SellerID, actionTaskRead) {
+		respondWithError(w, "incorrect task_id", http.StatusNotFound)
+		return
+	}
+	c.provideInfo(taskID, w, r)
 }
 
 func (c *Controller) provideInfo(id int64, w http.ResponseWriter, r *http.Request) {
-	log, hasTask := c.getTaskLog(id)
+	log, hasTask := c.getTaskLog(r.Context(), id)
 
 	if !hasTask {
 		respondWithError(w, "incorrect task_id", http.StatusNotFound)
 		return
 	}
-	jData, err := json.Marshal(log)
-	if err != nil {
-		fmt.Fprintln(w, "Internal server error")
-		return
-	}
 	if log.Status == "ERROR: Parsing error. Cannot load file" {
-		w.WriteHeader(http.StatusBadRequest)
-	} else {
-		w.WriteHeader(http.StatusOK)
+		respondWithJSON(w, log, http.StatusBadRequest)
+		return
 	}
-	w.Write(jData)
+	respondWithJSON(w, log, http.StatusOK)
 }
 
 //HomePage обработка запросов /
@@ -119,176 +154,349 @@ func (c *Controller) OffersHandler(w http.ResponseWriter, r *http.Request) {
 
 func (c *Controller) getOfferHandler(w http.ResponseWriter, r *http.Request) {
 	var search getOffersReq
-	var offers []parser.Offer
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		respondWithError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	json.Unmarshal(body, &search)
+	c.searchOffers(w, r, search)
+}
+
+//searchOffersHandler обработка запросов GET /v1/offers?seller_id=&offer_id=&q=&as_of=
+func (c *Controller) searchOffersHandler(w http.ResponseWriter, r *http.Request) {
+	if search, ok := offerSearchQuery(w, r); ok {
+		c.searchOffers(w, r, search)
+	}
+}
 
-	var query []string
-	if search.OfferID != 0 {
-		query = append(query, fmt.Sprintf("id=%d", search.OfferID))
+//sellerOffersHandler обработка запросов /v1/sellers/{seller_id}/offers:
+//GET ищет товары продавца (?offer_id=&q=&as_of=), POST загружает файл по url из тела запроса или сам xlsx файл из тела
+func (c *Controller) sellerOffersHandler(w http.ResponseWriter, r *http.Request, sellerID int) {
+	if r.Method == http.MethodPost {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == xlsxType {
+			c.uploadHandler(w, r, sellerID)
+			return
+		}
+		var data api.ImportRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			respondWithError(w, "incorrect request body", http.StatusBadRequest)
+			return
+		}
+		data.SellerID = sellerID
+		c.importURL(w, r, data)
+		return
 	}
-	if search.SellerID != 0 {
-		query = append(query, fmt.Sprintf("seller_id=%d", search.SellerID))
+	if search, ok := offerSearchQuery(w, r); ok {
+		search.SellerID = sellerID
+		c.searchOffers(w, r, search)
 	}
-	query = append(query, fmt.Sprintf(`"name" LIKE %s`, "'%"+search.NameSerch+"%'"))
+}
 
-	rows, err := c.db.Query(`SELECT * FROM "offer" WHERE ` + fmt.Sprint(strings.Join(query, " AND ")))
-	for rows.Next() {
-		var offer parser.Offer
-		err = rows.Scan(&offer.OfferID, &offer.Name, &offer.Price, &offer.Quantity, &offer.Available, &offer.SellerID)
-		if err != nil {
-			fmt.Println(err)
+//offerSearchQuery читает условия поиска товаров из параметров запроса, на неверные значения отвечает 400
+func offerSearchQuery(w http.ResponseWriter, r *http.Request) (getOffersReq, bool) {
+	query := r.URL.Query()
+	search := getOffersReq{NameSerch: query.Get("q")}
+	var err error
+	if value := query.Get("seller_id"); value != "" {
+		if search.SellerID, err = strconv.Atoi(value); err != nil {
+			respondWithError(w, "incorrect seller_id", http.StatusBadRequest)
+			return search, false
 		}
-		offers = append(offers, offer)
 	}
-	if len(offers) == 0 {
-		respondWithError(w, "No match", http.StatusNotFound)
+	if value := query.Get("offer_id"); value != "" {
+		if search.OfferID, err = strconv.Atoi(value); err != nil {
+			respondWithError(w, "incorrect offer_id", http.StatusBadRequest)
+			return search, false
+		}
+	}
+	if value := query.Get("as_of"); value != "" {
+		if search.AsOf, err = time.Parse(time.RFC3339, value); err != nil {
+			respondWithError(w, "incorrect as_of, want RFC 3339 time", http.StatusBadRequest)
+			return search, false
+		}
+	}
+	return search, true
+}
+
+//searchOffers отвечает найденными товарами. Ключ продавца без seller_id ищет среди своих товаров
+func (c *Controller) searchOffers(w http.ResponseWriter, r *http.Request, search getOffersReq) {
+	if own, ok := ownSeller(r); ok && search.SellerID == 0 {
+		search.SellerID = own
+	}
+	if !authorize(r, search.SellerID, actionRead) {
+		respondForbidden(w)
 		return
 	}
 
-	jOffers, err := json.Marshal(offers)
+	offers, err := c.store.SearchOffers(r.Context(), store.OfferSearch{
+		OfferID:    search.OfferID,
+		SellerID:   search.SellerID,
+		NameSearch: search.NameSerch,
+		AsOf:       search.AsOf,
+	})
 	if err != nil {
-		fmt.Fprintln(w, "Internal server error")
+		slog.ErrorContext(r.Context(), "cannot search offers", "err", err)
+		respondWithError(w, "Service unavailable", http.StatusServiceUnavailable)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(jOffers)
+	if len(offers) == 0 {
+		respondWithError(w, "No match", http.StatusNotFound)
+		return
+	}
+
+	respondWithJSON(w, offers, http.StatusOK)
 }
 
 func (c *Controller) postOfferHandler(w http.ResponseWriter, r *http.Request) {
-	var data postOffersRequest
+	var data api.ImportRequest
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println(err)
+		slog.DebugContext(r.Context(), "cannot read request body", "err", err)
+		respondWithError(w, "incorrect request body", http.StatusBadRequest)
 		return
 	}
 	json.Unmarshal(body, &data)
-	if data.URL != "" && data.SellerID != 0 {
-		if !c.hasSeller(data.SellerID) {
-			c.insertSeller(data.SellerID)
-		}
-		logID := c.insertTaskLog(data.URL, data.SellerID)
-		if data.Async {
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, "Processing started, your task ID is %d", logID)
-			go c.process(data.URL, data.SellerID, logID)
-			return
-		}
-		c.process(data.URL, data.SellerID, logID)
-		c.provideInfo(logID, w, r)
-	}
+	c.importURL(w, r, data)
 }
 
-func (c *Controller) getTaskLog(logID int64) (*infoResponse, bool) {
-	var url string
-	var sellerID int
-	l := infoResponse{}
-	err := c.db.QueryRow(
-		`SELECT * from "task_log" WHERE  id=$1`, logID).Scan(&l.TaskID, &url, &sellerID, &l.Status, &l.ElapsedTime, &l.LinesParsed, &l.NewOffers, &l.UpdatedOffers, &l.Errors)
+//importURL создает задачу загрузки файла по data.URL и выполняет ее сразу или, если data.Async, в фоне
+func (c *Controller) importURL(w http.ResponseWriter, r *http.Request, data api.ImportRequest) {
+	if errs := data.Validate(); len(errs) > 0 {
+		respondWithDetails(w, errs[0].Message, http.StatusBadRequest, errs)
+		return
+	}
+	if !authorize(r, data.SellerID, actionIngest) {
+		respondForbidden(w)
+		return
+	}
+	if !c.ensureSeller(w, r, data.SellerID) {
+		return
+	}
+	logID, err := c.store.CreateTask(r.Context(), data.URL, data.SellerID)
 	if err != nil {
-		fmt.Println(err)
-		return nil, false
+		slog.ErrorContext(r.Context(), "cannot create task", "err", err)
+		respondWithError(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	opts := importOptions{dryRun: data.DryRun, replace: data.Replace}
+	run := func(ctx context.Context) { c.process(ctx, data.URL, data.SellerID, logID, opts) }
+	if data.Async {
+		respondAccepted(w, logID)
+		c.runImport(r.Context(), true, logID, run)
+		return
 	}
-	return &l, true
+	c.runImport(r.Context(), false, logID, run)
+	c.provideInfo(logID, w, r)
 }
 
-func (c *Controller) hasSeller(sellerID int) bool {
-	var currentSellerID int
-	err := c.db.QueryRow(
-		`SELECT * from "seller" WHERE id=$1`, sellerID,
-	).Scan(&currentSellerID)
+func (c *Controller) getTaskLog(ctx context.Context, logID int64) (*api.Task, bool) {
+	task, err := c.store.GetTask(ctx, logID)
 	if err != nil {
-		return false
+		slog.ErrorContext(ctx, "cannot get task", "task_id", logID, "err", err)
+		return nil, false
 	}
-	return true
+	resp := taskResponse(*task)
+	return &resp, true
 }
 
-func (c *Controller) insertSeller(sellerID int) {
-	c.db.Exec(fmt.Sprintf(`INSERT INTO "seller" ("id") VALUES(%d)`, sellerID))
-
+//taskResponse состояние задачи для ответа API
+func taskResponse(task store.Task) api.Task {
+	return api.Task{
+		TaskID:        task.ID,
+		Status:        task.Status,
+		ElapsedTime:   task.ElapsedTime,
+		LinesParsed:   task.LinesParsed,
+		NewOffers:     task.NewOffers,
+		UpdatedOffers: task.UpdatedOffers,
+		Errors:        task.Errors,
+		DeletedOffers: task.DeletedOffers,
+	}
 }
 
-func (c *Controller) insertTaskLog(url string, sellerID int) int64 {
-	var lid int64
-	c.db.QueryRow(`INSERT INTO "task_log" ("status", "url", "seller_id") VALUES('Processing...', $1, $2) RETURNING id`, url, sellerID).Scan(&lid)
-	return lid
+//importOptions режим импорта. Нулевое значение добавляет и обновляет товары
+type importOptions struct {
+	//dryRun только сохраняет изменения для просмотра, товары не меняются
+	dryRun bool
+	//replace удаляет товары продавца, которых нет в файле
+	replace bool
 }
 
-func (c *Controller) process(url string, sellerID int, logID int64) {
-	resp, err := http.Get(url)
-	if err != nil {
-		info := infoResponse{logID, "ERROR: Parsing error. Cannot load file", "", 0, 0, 0, 0}
-		c.updateTaskLog(info)
+//process загружает файл по url и импортирует товары. Ждет свободного места в пуле загрузок.
+//Если ctx отменен остановкой сервера, обычный импорт возвращается в очередь, а в другом режиме завершается с ошибкой:
+//очередь хранит только ссылку на файл
+func (c *Controller) process(ctx context.Context, url string, sellerID int, logID int64, opts importOptions) {
+	ctx = logging.With(ctx, "task_id", logID, "seller_id", sellerID)
+	ctx, span := startImport(ctx, logID, sellerID, attribute.String("url.full", url))
+	defer span.End()
+	c.waiting.Add(1)
+	select {
+	case c.workers <- struct{}{}:
+		c.waiting.Add(-1)
+		defer func() { <-c.workers }()
+	case <-ctx.Done():
+		c.waiting.Add(-1)
+		c.interrupted(ctx, logID, 0, opts == importOptions{})
+		return
+	}
+	slog.InfoContext(ctx, "import started", "url", url)
+	span.AddEvent("worker acquired")
+
+	downloadStart := time.Now()
+	downloadCtx, downloadSpan := tracing.Start(ctx, "download")
+	data, err := c.fetch(downloadCtx, url)
+	downloadSpan.SetAttributes(attribute.Int("file.bytes", len(data)))
+	tracing.End(downloadSpan, err)
+	metrics.ObservePhase(metrics.PhaseDownload, downloadStart)
+	if ctx.Err() != nil {
+		c.interrupted(ctx, logID, 0, opts == importOptions{})
+		return
+	}
+	if err == errFileTooLarge {
+		c.failTask(ctx, logID, "ERROR: File is too large", 0)
 		return
 	}
-	defer resp.Body.Close()
-
-	f, err := parser.OpenReader(resp.Body)
 	if err != nil {
-		info := infoResponse{logID, "ERROR: Parsing error. Cannot load file", "", 0, 0, 0, 0}
-		c.updateTaskLog(info)
+		slog.WarnContext(ctx, "cannot load file", "err", err)
+		c.failTask(ctx, logID, "ERROR: Parsing error. Cannot load file", 0)
 		return
 	}
 
 	start := time.Now()
-	offers, numberOfErrors := parser.ParseExcel(f)
-
-	updates := 0
-	inserts := 0
-	for i := 0; i < len(offers); i++ {
-		offer, hasOffer := c.getOffer(offers[i].OfferID, sellerID)
-		if !hasOffer {
-			c.insertOffer(offers[i], sellerID)
-			inserts++
-			continue
-		}
-		if *offer != offers[i] {
-			c.updateOffer(offers[i], sellerID)
-			updates++
-		}
+	_, parseSpan := tracing.Start(ctx, "parse")
+	f, err := parser.OpenReader(io.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		tracing.End(parseSpan, err)
+		c.failTask(ctx, logID, "ERROR: Parsing error. Cannot load file", 0)
+		return
+	}
+	offers, rowErrors := parser.ParseExcel(f)
+	endParse(parseSpan, offers, rowErrors)
+	metrics.ObservePhase(metrics.PhaseParse, start)
+	if err := c.importOffers(ctx, offers, rowErrors, sellerID, logID, start, opts); err != nil {
+		c.interrupted(ctx, logID, rowErrors.Total(), opts == importOptions{})
 	}
-	t := time.Now()
-	elapsed := t.Sub(start)
-	info := infoResponse{logID, "Finished", elapsed.String(), len(offers) + numberOfErrors, inserts, updates, numberOfErrors}
-	c.updateTaskLog(info)
 }
 
-func (c *Controller) updateTaskLog(info infoResponse) {
-	c.db.Exec(
-		`UPDATE task_log SET status=$1, elapsed_time=$2, lines_parsed=$3, new_offers=$4, updated_offers=$5, errors=$6 WHERE id=$7`,
-		info.Status, info.ElapsedTime, info.LinesParsed, info.NewOffers, info.UpdatedOffers, info.Errors, info.TaskID,
-	)
-}
+var errFileTooLarge = errors.New("file is too large")
 
-func (c *Controller) updateOffer(offer parser.Offer, sellerID int) {
-	c.db.Exec(`UPDATE offer SET name=$1, price=$2, quantity=$3, available=$4 WHERE id=$5 AND seller_id=$6`,
-		offer.Name, offer.Price, offer.Quantity, offer.Available, offer.OfferID, sellerID,
-	)
+//fetch загружает файл не больше maxFileBytes
+func (c *Controller) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > c.maxFileBytes {
+		return nil, errFileTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.maxFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > c.maxFileBytes {
+		return nil, errFileTooLarge
+	}
+	return data, nil
 }
 
-func (c *Controller) getOffer(offerID int, sellerID int) (*parser.Offer, bool) {
-	var offer parser.Offer
-	var currentSellerID int
+//importOffers записывает разобранные товары в базу и итог в task_log.
+//start начало разбора файла, от него считается время импорта.
+//Если ctx отменен, товары не записываются, статус задачи не меняется и возвращается ошибка ctx
+func (c *Controller) importOffers(ctx context.Context, offers []parser.Offer, rowErrors parser.RowErrors, sellerID int, logID int64, start time.Time, opts importOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	numberOfErrors := rowErrors.Total()
+	task := store.Task{ID: logID, Status: "Finished", LinesParsed: len(offers) + numberOfErrors, Errors: numberOfErrors}
+	writeStart := time.Now()
+	writeCtx, writeSpan := tracing.Start(ctx, "write", attribute.Int("offers", len(offers)))
+	var err error
+	if opts == (importOptions{}) {
+		task.NewOffers, task.UpdatedOffers, err = c.store.UpsertOffers(writeCtx, sellerID, logID, offers)
+	} else {
+		err = c.writeDiffs(writeCtx, offers, sellerID, opts, &task)
+	}
+	writeSpan.SetAttributes(attribute.Int("offers.inserted", task.NewOffers), attribute.Int("offers.updated", task.UpdatedOffers),
+		attribute.Int("offers.deleted", task.DeletedOffers))
+	tracing.End(writeSpan, err)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	metrics.ObservePhase(metrics.PhaseWrite, writeStart)
+	metrics.AddRowErrors(rowErrors)
+	if err == store.ErrChanged {
+		c.failTask(ctx, logID, "ERROR: Offers changed during import", numberOfErrors)
+		return nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot save offers", "err", err)
+		c.failTask(ctx, logID, "ERROR: Cannot save offers", numberOfErrors)
+		return nil
+	}
+	elapsed := time.Since(start)
+	task.ElapsedTime = elapsed.String()
+	c.updateTaskLog(context.WithoutCancel(ctx), task)
+	metrics.ObserveRows(task.LinesParsed, elapsed)
+	if task.Status == store.TaskPreview {
+		metrics.ImportDone("preview")
+	} else {
+		metrics.ImportDone("finished")
+	}
+	slog.InfoContext(ctx, "import finished", "status", task.Status, "lines_parsed", task.LinesParsed,
+		"new_offers", task.NewOffers, "updated_offers", task.UpdatedOffers, "deleted_offers", task.DeletedOffers,
+		"errors", numberOfErrors, "elapsed", elapsed)
+	return nil
+}
 
-	err := c.db.QueryRow(
-		`SELECT * from "offer" WHERE  id=$1 AND seller_id=$2`, offerID, sellerID,
-	).Scan(&offer.OfferID, &offer.Name, &offer.Price, &offer.Quantity, &offer.Available, &currentSellerID)
+//writeDiffs сравнивает товары с текущими товарами продавца и записывает изменения в режиме opts,
+//а их число в task. Пробный импорт сохраняет изменения для просмотра и получает статус store.TaskPreview
+func (c *Controller) writeDiffs(ctx context.Context, offers []parser.Offer, sellerID int, opts importOptions, task *store.Task) error {
+	current, err := c.store.SearchOffers(ctx, store.OfferSearch{SellerID: sellerID})
 	if err != nil {
-		return nil, false
+		return err
+	}
+	diffs := store.DiffOffers(sellerID, current, offers, opts.replace)
+	if opts.dryRun {
+		err = c.store.SavePreview(ctx, task.ID, diffs)
+		task.Status = store.TaskPreview
+	} else {
+		err = c.store.ApplyOfferDiffs(ctx, sellerID, task.ID, diffs)
 	}
-	return &offer, true
+	if err != nil {
+		return err
+	}
+	task.NewOffers, task.UpdatedOffers, task.DeletedOffers = store.CountDiffs(diffs)
+	return nil
 }
 
-func (c *Controller) insertOffer(offer parser.Offer, sellerID int) {
-	c.db.Exec(
-		`INSERT INTO public.offer
-		(id, name, price, quantity, available, seller_id)
-		VALUES($1, $2, $3, $4, $5, $6);`,
-		offer.OfferID, offer.Name, offer.Price, offer.Quantity, offer.Available, sellerID,
-	)
+//failTask завершает задачу с ошибкой
+func (c *Controller) failTask(ctx context.Context, logID int64, status string, numberOfErrors int) {
+	slog.WarnContext(ctx, "import failed", "status", status)
+	trace.SpanFromContext(ctx).SetStatus(codes.Error, status)
+	c.updateTaskLog(context.WithoutCancel(ctx), store.Task{ID: logID, Status: status, Errors: numberOfErrors})
+	metrics.ImportDone("failed")
+}
+
+//startImport начинает спан импорта задачи logID. Спан асинхронного импорта продолжает трассировку запроса,
+//который его запустил, и может закончиться позже спана запроса
+func startImport(ctx context.Context, logID int64, sellerID int, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.Int64("task.id", logID), attribute.Int("seller.id", sellerID))
+	return tracing.Start(ctx, "import", attrs...)
+}
+
+//endParse завершает спан разбора файла с числом разобранных и отброшенных строк
+func endParse(span trace.Span, offers []parser.Offer, rowErrors parser.RowErrors) {
+	span.SetAttributes(attribute.Int("rows.parsed", len(offers)), attribute.Int("rows.errors", rowErrors.Total()))
+	span.End()
+}
+
+func (c *Controller) updateTaskLog(ctx context.Context, task store.Task) {
+	if err := c.store.UpdateTask(ctx, task); err != nil {
+		slog.ErrorContext(ctx, "cannot update task", "task_id", task.ID, "err", err)
+	}
 }
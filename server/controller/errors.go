@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/parser"
+)
+
+//errorCode код ошибки из кода ответа: 404 это not_found
+func errorCode(statusCode int) string {
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(statusCode), " ", "_"))
+}
+
+func respondWithError(w http.ResponseWriter, errorText string, statusCode int) {
+	respondWithDetails(w, errorText, statusCode, nil)
+}
+
+//respondWithDetails отвечает ошибкой с подробностями details
+func respondWithDetails(w http.ResponseWriter, errorText string, statusCode int, details interface{}) {
+	resp := api.ErrorResponse{Error: api.Error{
+		Code:      errorCode(statusCode),
+		Message:   errorText,
+		Details:   details,
+		RequestID: w.Header().Get("X-Request-ID"),
+	}}
+	jData, err := json.Marshal(resp)
+	if err != nil {
+		resp.Error.Details = nil
+		jData, _ = json.Marshal(resp)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(jData)
+}
+
+//respondWithValidationError отвечает 400 на ошибку проверки товара, поле *parser.FieldError попадает в details
+func respondWithValidationError(w http.ResponseWriter, err error) {
+	var fieldErr *parser.FieldError
+	if errors.As(err, &fieldErr) {
+		respondWithDetails(w, err.Error(), http.StatusBadRequest, []api.FieldError{{Field: fieldErr.Field, Message: fieldErr.Message}})
+		return
+	}
+	respondWithError(w, err.Error(), http.StatusBadRequest)
+}
+
+//Recover отвечает 500 вместо падения сервера, если обработчик паникует, и пишет стек в журнал
+func (c *Controller) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			slog.ErrorContext(r.Context(), "handler panicked", "panic", v, "stack", string(debug.Stack()))
+			if rec.status == 0 {
+				respondWithError(w, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+//recoverImport завершает задачу logID с ошибкой, если импорт run паникует, вместо падения сервера
+func (c *Controller) recoverImport(logID int64, run func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		defer func() {
+			if v := recover(); v != nil {
+				slog.ErrorContext(ctx, "import panicked", "panic", v, "stack", string(debug.Stack()))
+				c.failTask(ctx, logID, "ERROR: Internal error", 0)
+			}
+		}()
+		run(ctx)
+	}
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+//taskEventsInterval как часто поток событий задачи проверяет ее состояние
+var taskEventsInterval = 500 * time.Millisecond
+
+//respondAccepted отвечает 202 со ссылками на состояние задачи и поток ее событий
+func respondAccepted(w http.ResponseWriter, taskID int64) {
+	statusURL := "/v1/tasks/" + strconv.FormatInt(taskID, 10)
+	w.Header().Set("Location", statusURL)
+	respondWithJSON(w, api.Accepted{
+		TaskID:    taskID,
+		Status:    store.TaskProcessing,
+		StatusURL: statusURL,
+		EventsURL: statusURL + "/events",
+	}, http.StatusAccepted)
+}
+
+//taskEventsHandler обработка запросов GET /v1/tasks/{task_id}/events: поток Server-Sent Events.
+//Событие status с состоянием задачи отправляется сразу и при каждом изменении, после завершения задачи поток закрывается
+func (c *Controller) taskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(r.PathValue("task_id"), 10, 64)
+	if err != nil {
+		respondWithError(w, "incorrect task_id", http.StatusNotFound)
+		return
+	}
+	task, err := c.store.GetTask(r.Context(), taskID)
+	if err == nil && !authorize(r, task.SellerID, actionTaskRead) {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err, "incorrect task_id")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(taskEventsInterval)
+	defer ticker.Stop()
+	var sent *api.Task
+	for {
+		info, ok := c.getTaskLog(r.Context(), taskID)
+		if !ok {
+			return
+		}
+		if sent == nil || *info != *sent {
+			data, _ := json.Marshal(info)
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			sent = info
+		}
+		if info.Done() {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
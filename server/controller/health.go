@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/migrate"
+	"github.com/goserg/Golang-merchant-API/version"
+)
+
+//SchemaStatus состояние миграций схемы, реализуется migrate.Migrator
+type SchemaStatus interface {
+	Status(ctx context.Context) ([]migrate.Status, error)
+}
+
+type check struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type readyResponse struct {
+	Status string           `json:"status"`
+	Checks map[string]check `json:"checks"`
+}
+
+type versionResponse struct {
+	version.Info
+	SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+//HealthHandler обработка запросов /healthz: процесс жив и отвечает
+func (c *Controller) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	respondWithJSON(w, check{Status: "ok"}, http.StatusOK)
+}
+
+//ReadyHandler обработка запросов /readyz: сервер может обрабатывать запросы.
+//Проверяет базу данных, миграции, пул импортов и длину очереди импортов, при ошибке отвечает 503
+func (c *Controller) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	resp := readyResponse{Status: "ready", Checks: map[string]check{}}
+	fail := func(name string, detail string) {
+		resp.Status = "not ready"
+		resp.Checks[name] = check{Status: "fail", Detail: detail}
+	}
+
+	if err := c.store.Ping(ctx); err != nil {
+		slog.WarnContext(ctx, "readiness: database is unavailable", "err", err)
+		fail("database", "database is unavailable")
+	} else {
+		resp.Checks["database"] = check{Status: "ok"}
+	}
+
+	if c.Schema != nil {
+		pending, err := c.pendingMigrations(ctx)
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "readiness: cannot check migrations", "err", err)
+			fail("migrations", "cannot check migrations")
+		case pending > 0:
+			fail("migrations", "schema has pending migrations")
+		default:
+			resp.Checks["migrations"] = check{Status: "ok"}
+		}
+	}
+
+	c.mu.Lock()
+	closing := c.closing
+	c.mu.Unlock()
+	if closing {
+		fail("workers", "server is shutting down")
+	} else {
+		resp.Checks["workers"] = check{Status: "ok"}
+	}
+
+	waiting := c.QueueDepth()
+	depth := fmt.Sprintf("%d imports waiting, limit %d", waiting, c.MaxQueue)
+	if waiting > c.MaxQueue {
+		fail("queue", depth)
+	} else {
+		resp.Checks["queue"] = check{Status: "ok", Detail: depth}
+	}
+
+	code := http.StatusOK
+	if resp.Status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	respondWithJSON(w, resp, code)
+}
+
+func (c *Controller) pendingMigrations(ctx context.Context) (int, error) {
+	statuses, err := c.Schema.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+//VersionHandler обработка запросов /version: сборка сервера и версия схемы базы
+func (c *Controller) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := versionResponse{Info: version.Get()}
+	if c.Schema != nil {
+		statuses, err := c.Schema.Status(r.Context())
+		if err != nil {
+			slog.WarnContext(r.Context(), "cannot get schema version", "err", err)
+		}
+		for _, status := range statuses {
+			if status.AppliedAt != nil {
+				resp.SchemaVersion = status.Version
+			}
+		}
+	}
+	respondWithJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+type createKeyRequest struct {
+	SellerID int    `json:"seller_id"`
+	Role     string `json:"role"`
+}
+
+func (c *Controller) keysCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.listKeys(w, r)
+	case http.MethodPost:
+		c.createKey(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+//keyHandler отзывает ключ keyID (DELETE) или, если rotate, выпускает ему замену (POST)
+func (c *Controller) keyHandler(w http.ResponseWriter, r *http.Request, keyID int64, rotate bool) {
+	key, err := c.store.GetAPIKey(r.Context(), keyID)
+	if err == nil && (key.RevokedAt != nil || !canManageKey(r, key.Role, key.SellerID)) {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err, "key not found")
+		return
+	}
+	switch {
+	case rotate && r.Method == http.MethodPost:
+		c.rotateKey(w, r, key)
+	case !rotate && r.Method == http.MethodDelete:
+		if err := c.store.RevokeAPIKey(r.Context(), keyID); err != nil {
+			respondWithStoreError(w, r, err, "key not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case rotate:
+		w.Header().Set("Allow", "POST")
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		w.Header().Set("Allow", "DELETE")
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+//canManageKey ключами продавца управляют сам продавец и администратор, служебными ключами только администратор
+func canManageKey(r *http.Request, role string, sellerID int) bool {
+	if role == roleSeller {
+		return authorize(r, sellerID, actionWrite)
+	}
+	return authorize(r, 0, actionManage)
+}
+
+func (c *Controller) listKeys(w http.ResponseWriter, r *http.Request) {
+	sellerID := 0
+	if value := r.URL.Query().Get("seller_id"); value != "" {
+		var err error
+		sellerID, err = strconv.Atoi(value)
+		if err != nil {
+			respondWithError(w, "incorrect seller_id", http.StatusBadRequest)
+			return
+		}
+	}
+	if own, ok := ownSeller(r); ok && sellerID == 0 {
+		sellerID = own
+	}
+	if !authorize(r, sellerID, actionRead) {
+		respondForbidden(w)
+		return
+	}
+	keys, err := c.store.ListAPIKeys(r.Context(), sellerID)
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	respondWithJSON(w, keys, http.StatusOK)
+}
+
+func (c *Controller) createKey(w http.ResponseWriter, r *http.Request) {
+	var req createKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, "incorrect request body", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = roleSeller
+	}
+	switch req.Role {
+	case roleAdmin, roleSupport, roleIngest:
+		if req.SellerID != 0 {
+			respondWithError(w, "only seller keys can belong to a seller", http.StatusBadRequest)
+			return
+		}
+	case roleSeller:
+		if req.SellerID <= 0 {
+			respondWithError(w, "seller_id is required", http.StatusBadRequest)
+			return
+		}
+	default:
+		respondWithError(w, "incorrect role", http.StatusBadRequest)
+		return
+	}
+	if !canManageKey(r, req.Role, req.SellerID) {
+		respondForbidden(w)
+		return
+	}
+	if req.Role == roleSeller {
+		if _, err := c.store.GetSeller(r.Context(), req.SellerID); err != nil {
+			respondWithStoreError(w, r, err, "seller not found")
+			return
+		}
+	}
+	key, hash, err := newAPIKey(req.SellerID, req.Role)
+	if err == nil {
+		err = c.store.CreateAPIKey(r.Context(), key, hash)
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	respondWithJSON(w, key, http.StatusCreated)
+}
+
+//rotateKey отзывает ключ и выпускает вместо него новый с теми же правами
+func (c *Controller) rotateKey(w http.ResponseWriter, r *http.Request, old *store.APIKey) {
+	key, hash, err := newAPIKey(old.SellerID, old.Role)
+	if err == nil {
+		err = c.store.RotateAPIKey(r.Context(), old.ID, key, hash)
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err, "key not found")
+		return
+	}
+	respondWithJSON(w, key, http.StatusCreated)
+}
@@ -0,0 +1,263 @@
+package controller
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+//offerPatch частичное обновление товара, отсутствующие поля не меняются
+type offerPatch struct {
+	Name      *string  `json:"name"`
+	Price     *float64 `json:"price"`
+	Quantity  *int64   `json:"quantity"`
+	Available *bool    `json:"available"`
+}
+
+func (c *Controller) offerHandler(w http.ResponseWriter, r *http.Request, sellerID int, offerID int) {
+	a := actionWrite
+	if r.Method == http.MethodGet {
+		a = actionRead
+	}
+	if !authorize(r, sellerID, a) {
+		respondForbidden(w)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		c.getSingleOffer(w, r, sellerID, offerID)
+	case http.MethodPut:
+		c.putOffer(w, r, sellerID, offerID)
+	case http.MethodPatch:
+		c.patchOffer(w, r, sellerID, offerID)
+	case http.MethodDelete:
+		c.deleteOffer(w, r, sellerID, offerID)
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *Controller) getSingleOffer(w http.ResponseWriter, r *http.Request, sellerID int, offerID int) {
+	offer, err := c.store.GetOffer(r.Context(), sellerID, offerID)
+	if err == store.ErrNotFound {
+		respondWithError(w, "offer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "cannot get offer", "err", err)
+		respondWithError(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	respondWithOffer(w, *offer, http.StatusOK)
+}
+
+func (c *Controller) putOffer(w http.ResponseWriter, r *http.Request, sellerID int, offerID int) {
+	var offer parser.Offer
+	if err := json.NewDecoder(r.Body).Decode(&offer); err != nil {
+		respondWithError(w, "incorrect request body", http.StatusBadRequest)
+		return
+	}
+	offer.OfferID = offerID
+	offer.SellerID = sellerID
+	if err := offer.Validate(); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+	if !c.ensureSeller(w, r, sellerID) {
+		return
+	}
+	c.writeOffer(w, r, sellerID, offerID, true, func(current *parser.Offer) (*parser.Offer, error) {
+		return &offer, nil
+	})
+}
+
+func (c *Controller) patchOffer(w http.ResponseWriter, r *http.Request, sellerID int, offerID int) {
+	var patch offerPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		respondWithError(w, "incorrect request body", http.StatusBadRequest)
+		return
+	}
+	if !c.activeSeller(w, r, sellerID) {
+		return
+	}
+	c.writeOffer(w, r, sellerID, offerID, false, func(current *parser.Offer) (*parser.Offer, error) {
+		offer := *current
+		if patch.Name != nil {
+			offer.Name = *patch.Name
+		}
+		if patch.Price != nil {
+			offer.Price = *patch.Price
+		}
+		if patch.Quantity != nil {
+			offer.Quantity = *patch.Quantity
+		}
+		if patch.Available != nil {
+			offer.Available = *patch.Available
+		}
+		return &offer, offer.Validate()
+	})
+}
+
+func (c *Controller) deleteOffer(w http.ResponseWriter, r *http.Request, sellerID int, offerID int) {
+	if !c.activeSeller(w, r, sellerID) {
+		return
+	}
+	c.writeOffer(w, r, sellerID, offerID, false, func(current *parser.Offer) (*parser.Offer, error) {
+		return nil, nil
+	})
+}
+
+//requestError ошибка, которую изменение товара возвращает клиенту с заданным кодом
+type requestError struct {
+	statusCode int
+	text       string
+}
+
+func (e *requestError) Error() string {
+	return e.text
+}
+
+//writeOffer атомарно меняет товар с проверкой If-Match.
+//apply получает текущее состояние товара (nil, если его нет) и возвращает новое (nil для удаления)
+//или ошибку проверки *parser.FieldError.
+//Изменение записывается в task_log так же, как импорт файла: задача создается до изменения,
+//чтобы история товара ссылалась на нее, и завершается ошибкой, если изменение не выполнено
+func (c *Controller) writeOffer(w http.ResponseWriter, r *http.Request, sellerID int, offerID int, allowCreate bool,
+	apply func(current *parser.Offer) (*parser.Offer, error)) {
+	start := time.Now()
+	taskID, err := c.store.CreateTask(r.Context(), r.Method+" "+r.URL.Path, sellerID)
+	if err != nil {
+		respondWithStoreError(w, r, err, "offer not found")
+		return
+	}
+	fail := func(status string, errors int) {
+		c.updateTaskLog(r.Context(), store.Task{ID: taskID, Status: status, ElapsedTime: time.Since(start).String(), Errors: errors})
+	}
+	var previous, next *parser.Offer
+	err = c.store.ChangeOffer(r.Context(), sellerID, offerID, taskID, func(current *parser.Offer) (*parser.Offer, error) {
+		if current == nil && !allowCreate {
+			return nil, &requestError{http.StatusNotFound, "offer not found"}
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			if current == nil || !etagMatches(ifMatch, offerETag(*current)) {
+				return nil, &requestError{http.StatusPreconditionFailed, "offer was modified"}
+			}
+		}
+		var err error
+		next, err = apply(current)
+		if err != nil {
+			return nil, err
+		}
+		previous = current
+		return next, nil
+	})
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		fail("ERROR: "+reqErr.text, 0)
+		respondWithError(w, reqErr.text, reqErr.statusCode)
+		return
+	}
+	var fieldErr *parser.FieldError
+	if errors.As(err, &fieldErr) {
+		fail("ERROR: "+err.Error(), 1)
+		respondWithValidationError(w, err)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "cannot change offer", "err", err)
+		fail("ERROR: Cannot save offers", 0)
+		respondWithError(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	task := store.Task{ID: taskID, Status: "Finished", LinesParsed: 1, ElapsedTime: time.Since(start).String()}
+	switch {
+	case next == nil:
+		task.DeletedOffers = 1
+	case previous == nil:
+		task.NewOffers = 1
+	case *next != *previous:
+		task.UpdatedOffers = 1
+	}
+	c.updateTaskLog(r.Context(), task)
+
+	if next == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if previous == nil {
+		respondWithOffer(w, *next, http.StatusCreated)
+		return
+	}
+	respondWithOffer(w, *next, http.StatusOK)
+}
+
+//offerHistoryHandler обработка запросов GET /v1/sellers/{seller_id}/offers/{offer_id}/history:
+//изменения товара от старых к новым, в том числе удаление
+func (c *Controller) offerHistoryHandler(w http.ResponseWriter, r *http.Request, sellerID int, offerID int) {
+	if !authorize(r, sellerID, actionRead) {
+		respondForbidden(w)
+		return
+	}
+	events, err := c.store.OfferHistory(r.Context(), sellerID, offerID)
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	if len(events) == 0 {
+		respondWithError(w, "offer not found", http.StatusNotFound)
+		return
+	}
+	resp := make([]api.OfferEvent, 0, len(events))
+	for _, e := range events {
+		action, fields := offerChange(e.Old, e.New)
+		resp = append(resp, api.OfferEvent{
+			ID:        e.ID,
+			TaskID:    e.TaskID,
+			CreatedAt: e.CreatedAt,
+			Action:    action,
+			Old:       e.Old,
+			New:       e.New,
+			Fields:    fields,
+		})
+	}
+	respondWithJSON(w, resp, http.StatusOK)
+}
+
+func respondWithOffer(w http.ResponseWriter, offer parser.Offer, statusCode int) {
+	jData, err := json.Marshal(offer)
+	if err != nil {
+		respondWithError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", offerETag(offer))
+	w.WriteHeader(statusCode)
+	w.Write(jData)
+}
+
+//offerETag версия товара для оптимистичной блокировки, не зависит от seller_id
+func offerETag(offer parser.Offer) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d|%s|%v|%d|%t", offer.OfferID, offer.Name, offer.Price, offer.Quantity, offer.Available)))
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
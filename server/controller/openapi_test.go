@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+var (
+	specOnce   sync.Once
+	specRouter routers.Router
+	specErr    error
+)
+
+//openAPIRouter находит операции описания API, описание проверяется один раз
+func openAPIRouter(t *testing.T) routers.Router {
+	specOnce.Do(func() {
+		text := func(r io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (any, error) {
+			data, err := io.ReadAll(r)
+			return string(data), err
+		}
+		openapi3filter.RegisterBodyDecoder("application/x-ndjson", text)
+		openapi3filter.RegisterBodyDecoder("text/event-stream", text)
+		openapi3filter.RegisterBodyDecoder(xlsxType, text)
+		doc, err := openapi3.NewLoader().LoadFromData(api.Spec())
+		if err != nil {
+			specErr = err
+			return
+		}
+		specRouter, specErr = legacy.NewRouter(doc)
+	})
+	if specErr != nil {
+		t.Fatal(specErr)
+	}
+	return specRouter
+}
+
+//apiClient выполняет запросы к маршрутам контроллера и проверяет запросы и ответы по описанию API
+type apiClient struct {
+	t      *testing.T
+	mux    *http.ServeMux
+	key    string
+	tested map[string]bool
+}
+
+func newAPIClient(t *testing.T, c *Controller, key string) *apiClient {
+	mux := http.NewServeMux()
+	c.Routes(mux, nil)
+	return &apiClient{t: t, mux: mux, key: key, tested: make(map[string]bool)}
+}
+
+//do выполняет запрос и проверяет запрос и ответ по описанию
+func (a *apiClient) do(method, path, contentType, body string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.send(method, path, contentType, body, true)
+}
+
+//invalid выполняет заведомо неверный запрос и проверяет только ответ
+func (a *apiClient) invalid(method, path, body string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.send(method, path, "application/json", body, false)
+}
+
+func (a *apiClient) send(method, path, contentType, body string, validRequest bool) *httptest.ResponseRecorder {
+	a.t.Helper()
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if a.key != "" {
+			req.Header.Set("X-API-Key", a.key)
+		}
+		return req
+	}
+	rr := httptest.NewRecorder()
+	a.mux.ServeHTTP(rr, newRequest())
+
+	req := newRequest()
+	route, params, err := openAPIRouter(a.t).FindRoute(req)
+	if err != nil {
+		a.t.Errorf("%s %s is not described: %v", method, path, err)
+		return rr
+	}
+	a.tested[route.Operation.OperationID] = true
+	ctx := context.Background()
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: params,
+		Route:      route,
+		Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	}
+	if err := openapi3filter.ValidateRequest(ctx, input); err != nil && validRequest {
+		a.t.Errorf("%s %s: request does not match the description: %v", method, path, err)
+	}
+	err = openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rr.Code,
+		Header:                 rr.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(rr.Body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	if err != nil {
+		a.t.Errorf("%s %s: response %d %s does not match the description: %v", method, path, rr.Code, rr.Body.String(), err)
+	}
+	return rr
+}
+
+func (a *apiClient) json(method, path, body string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.do(method, path, "application/json", body)
+}
+
+//TestOpenAPI проверяет по описанию API ответы каждой описанной операции
+func TestOpenAPI(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Controller, s store.Store) {
+		c.SetAdminKey("admin-secret")
+		excels := httptest.NewServer(http.FileServer(http.Dir("../../mock_excel_api/excels")))
+		defer excels.Close()
+		a := newAPIClient(t, c, "admin-secret")
+
+		a.json("GET", "/healthz", "")
+		a.json("GET", "/readyz", "")
+		a.json("GET", "/version", "")
+
+		a.json("GET", "/v1/offers?seller_id=3", "")
+		a.json("GET", "/v1/offers?q=missing", "")
+		a.json("GET", "/v1/tasks/1", "")
+		a.json("GET", "/v1/tasks/100", "")
+		a.json("GET", "/v1/tasks/1/events", "")
+		a.json("GET", "/v1/tasks?seller_id=3", "")
+		a.json("POST", "/v1/tasks/1/cancel", "")
+		a.json("GET", "/v1/tasks/100/events", "")
+
+		a.json("POST", "/v1/sellers", `{"id":5,"name":"Shop","email":"shop@example.com"}`)
+		a.json("POST", "/v1/sellers", `{"id":5}`)
+		a.invalid("POST", "/v1/sellers", `{"id":6,"email":"wrong"}`)
+		a.json("GET", "/v1/sellers", "")
+		a.json("GET", "/v1/sellers/5", "")
+		a.json("PATCH", "/v1/sellers/5", `{"name":"New name"}`)
+
+		a.json("POST", "/v1/sellers/3/offers", fmt.Sprintf(`{"url":%q}`, excels.URL+"/1.xlsx"))
+		a.json("POST", "/v1/sellers/3/offers", `{"url":"http://127.0.0.1:1/missing.xlsx"}`)
+		a.json("POST", "/v1/sellers/3/offers", fmt.Sprintf(`{"url":%q,"async":true}`, excels.URL+"/1.xlsx"))
+		a.invalid("POST", "/v1/sellers/3/offers", `{}`)
+		export := a.json("GET", "/v1/sellers/3/offers:export", "")
+		a.do("POST", "/v1/sellers/3/offers", xlsxType, export.Body.String())
+		a.do("POST", "/v1/sellers/3/offers?async=true", xlsxType, export.Body.String())
+		a.json("GET", "/v1/sellers/100/offers:export", "")
+		a.do("POST", "/v1/validate", xlsxType, export.Body.String())
+		a.do("POST", "/v1/validate?profile=header", xlsxType, export.Body.String())
+		a.do("POST", "/v1/validate", xlsxType, "not a file")
+		a.json("GET", "/v1/sellers/3/offers?q=test", "")
+		a.json("POST", "/v1/sellers/3/offers:batch", `[{"offer_id":5,"name":"batch","price":1,"quantity":1,"available":true}]`)
+		a.do("POST", "/v1/sellers/3/offers:batch?async=true", "application/x-ndjson", `{"offer_id":6,"name":"ndjson","price":1,"quantity":1,"available":true}`)
+		dryRun := a.json("POST", "/v1/sellers/3/offers:batch?dry_run=true&replace=true", `[{"offer_id":1,"name":"renamed","price":1,"quantity":1,"available":true}]`)
+		dryRunID := strings.Split(strings.TrimPrefix(dryRun.Body.String(), `{"task_id":`), ",")[0]
+		a.json("GET", "/v1/tasks/"+dryRunID+"/preview?limit=2", "")
+		a.invalid("GET", "/v1/tasks/"+dryRunID+"/preview?limit=0", "")
+		a.json("GET", "/v1/tasks/1/preview", "")
+		a.json("POST", "/v1/tasks/"+dryRunID+"/apply", "")
+		a.json("POST", "/v1/tasks/"+dryRunID+"/apply", "")
+		a.json("POST", "/v1/tasks/"+dryRunID+"/revert", "")
+		a.json("POST", "/v1/tasks/"+dryRunID+"/revert", "")
+		a.invalid("POST", "/v1/tasks/"+dryRunID+"/revert?force=maybe", "")
+		a.json("GET", "/v1/tasks/1/diff/"+dryRunID+"?limit=1", "")
+		a.json("GET", "/v1/tasks/1/diff/"+dryRunID+"?format=xlsx", "")
+		a.invalid("GET", "/v1/tasks/1/diff/"+dryRunID+"?format=csv", "")
+		a.json("GET", "/v1/tasks/1/diff/100", "")
+
+		a.json("PUT", "/v1/sellers/3/offers/7", `{"name":"put","price":2,"quantity":1,"available":true}`)
+		offer := a.json("GET", "/v1/sellers/3/offers/7", "")
+		a.invalid("PUT", "/v1/sellers/3/offers/7", `{"name":"put","price":-1}`)
+		req := a.json("PATCH", "/v1/sellers/3/offers/7", `{"price":3}`)
+		if req.Header().Get("ETag") == offer.Header().Get("ETag") {
+			t.Error("ETag did not change")
+		}
+		a.json("DELETE", "/v1/sellers/3/offers/7", "")
+		a.json("GET", "/v1/sellers/3/offers/7", "")
+		a.json("GET", "/v1/sellers/3/offers/7/history", "")
+		a.json("GET", "/v1/sellers/3/offers/100/history", "")
+		a.json("GET", "/v1/sellers/3/offers?as_of=2000-01-01T00:00:00Z", "")
+		a.invalid("GET", "/v1/offers?seller_id=3&as_of=yesterday", "")
+
+		key := a.json("POST", "/v1/keys", `{"seller_id":3}`)
+		keyID := strings.Split(strings.TrimPrefix(key.Body.String(), `{"id":`), ",")[0]
+		a.json("GET", "/v1/keys", "")
+		a.json("POST", "/v1/keys/"+keyID+"/rotate", "")
+		a.json("DELETE", "/v1/keys/"+keyID, "")
+
+		a.json("GET", "/v1/audit?limit=10", "")
+		a.invalid("GET", "/v1/audit?limit=0", "")
+		a.json("DELETE", "/v1/sellers/5", "")
+
+		anonymous := newAPIClient(t, c, "")
+		anonymous.json("GET", "/v1/sellers", "")
+
+		doc, _ := openapi3.NewLoader().LoadFromData(api.Spec())
+		for path, item := range doc.Paths.Map() {
+			for method, op := range item.Operations() {
+				if !a.tested[op.OperationID] {
+					t.Errorf("%s %s (%s) is not tested", method, path, op.OperationID)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/logging"
+)
+
+//requestIDPattern допустимый ID запроса от клиента или балансировщика, иначе генерируется новый
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+//RequestID присваивает запросу ID из заголовка X-Request-ID или новый, возвращает его в ответе
+//и добавляет ко всем записям журнала по запросу, в том числе к записям запущенного им импорта.
+//По окончании запроса пишет в журнал метод, путь, код ответа и время обработки
+func (c *Controller) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := logging.WithRequestID(r.Context(), id)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		slog.InfoContext(ctx, "request", "method", r.Method, "path", r.URL.Path,
+			"status", rec.status, "duration", time.Since(start), "remote_addr", r.RemoteAddr)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goserg/Golang-merchant-API/api"
+)
+
+//router регистрирует маршруты на http.ServeMux и отвечает 405 с заголовком Allow на методы,
+//для которых у пути нет обработчика
+type router struct {
+	mux     *http.ServeMux
+	wrap    func(pattern string, handler http.Handler) http.Handler
+	protect func(handler http.HandlerFunc) http.Handler
+	allowed map[string][]string
+}
+
+//handle регистрирует handler, который требует API ключ, для пути path и методов methods.
+//Без methods обработчик получает запросы с любым методом и сам отвечает 405
+func (rt *router) handle(path string, handler http.HandlerFunc, methods ...string) {
+	rt.public(path, rt.protect(handler), methods...)
+}
+
+//public регистрирует handler, доступный без API ключа. authorize в таком обработчике всегда отказывает
+func (rt *router) public(path string, handler http.Handler, methods ...string) {
+	if len(methods) == 0 {
+		rt.mux.Handle(path, rt.wrap(path, handler))
+		return
+	}
+	wrapped := rt.wrap(path, handler)
+	for _, method := range methods {
+		rt.mux.Handle(method+" "+path, wrapped)
+	}
+	if _, ok := rt.allowed[path]; !ok {
+		rt.mux.Handle(path, rt.wrap(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", strings.Join(rt.allowed[path], ", "))
+			respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		})))
+	}
+	rt.allowed[path] = append(rt.allowed[path], methods...)
+	if slices.Contains(methods, http.MethodGet) {
+		rt.allowed[path] = append(rt.allowed[path], http.MethodHead)
+	}
+}
+
+//Routes регистрирует на mux маршруты API /v1, проверки состояния и старые маршруты без версии для совместимости.
+//wrap оборачивает каждый обработчик, например метриками; pattern это путь без метода. wrap может быть nil
+func (c *Controller) Routes(mux *http.ServeMux, wrap func(pattern string, handler http.Handler) http.Handler) {
+	if wrap == nil {
+		wrap = func(_ string, handler http.Handler) http.Handler { return handler }
+	}
+	rt := &router{mux: mux, wrap: wrap, protect: c.protect, allowed: make(map[string][]string)}
+	get, post, put, patch, del := http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete
+
+	//без ключа доступны только проверки состояния, версия и документация, остальные маршруты регистрирует handle
+	rt.public("/{$}", http.HandlerFunc(c.HomePage), get)
+	rt.public("/healthz", http.HandlerFunc(c.HealthHandler), get)
+	rt.public("/readyz", http.HandlerFunc(c.ReadyHandler), get)
+	rt.public("/version", http.HandlerFunc(c.VersionHandler), get)
+	rt.public("/openapi.json", http.HandlerFunc(api.SpecHandler), get)
+	rt.public("/docs", http.HandlerFunc(api.DocsHandler), get)
+
+	rt.handle("/v1/offers", c.searchOffersHandler, get)
+	rt.handle("/v1/tasks", c.tasksHandler, get)
+	rt.handle("/v1/tasks/{task_id}", c.taskHandler, get)
+	rt.handle("/v1/tasks/{task_id}/cancel", c.cancelTaskHandler, post)
+	rt.handle("/v1/tasks/{task_id}/events", c.taskEventsHandler, get)
+	rt.handle("/v1/tasks/{task_id}/preview", c.previewHandler, get)
+	rt.handle("/v1/tasks/{task_id}/apply", c.applyTaskHandler, post)
+	rt.handle("/v1/tasks/{task_id}/revert", c.revertTaskHandler, post)
+	rt.handle("/v1/tasks/{task_id}/diff/{other_id}", c.diffTasksHandler, get)
+	rt.handle("/v1/sellers", c.sellersCollectionHandler, get, post)
+	rt.handle("/v1/sellers/{seller_id}", c.withSeller(c.sellerHandler), get, patch, del)
+	rt.handle("/v1/sellers/{seller_id}/offers", c.withSeller(c.sellerOffersHandler), get, post)
+	rt.handle("/v1/sellers/{seller_id}/offers:batch", c.withSeller(c.batchHandler), post)
+	rt.handle("/v1/sellers/{seller_id}/offers:export", c.withSeller(c.exportHandler), get)
+	rt.handle("/v1/sellers/{seller_id}/offers/{offer_id}", c.withOffer(c.offerHandler), get, put, patch, del)
+	rt.handle("/v1/sellers/{seller_id}/offers/{offer_id}/history", c.withOffer(c.offerHistoryHandler), get)
+	rt.handle("/v1/validate", c.validateHandler, post)
+	rt.handle("/v1/keys", c.keysCollectionHandler, get, post)
+	rt.handle("/v1/keys/{key_id}", c.withKey(false), del)
+	rt.handle("/v1/keys/{key_id}/rotate", c.withKey(true), post)
+	rt.handle("/v1/audit", c.AuditHandler, get)
+
+	//маршруты без версии, как до появления /v1
+	rt.handle("/offers", c.OffersHandler, get, post)
+	rt.handle("/info", c.InfoHandler, get)
+	rt.handle("/sellers", c.sellersCollectionHandler)
+	rt.handle("/sellers/{seller_id}", c.withSeller(c.sellerHandler))
+	rt.handle("/sellers/{seller_id}/offers:batch", c.withSeller(c.batchHandler))
+	rt.handle("/sellers/{seller_id}/offers/{offer_id}", c.withOffer(c.offerHandler))
+	rt.handle("/keys", c.keysCollectionHandler)
+	rt.handle("/keys/{key_id}", c.legacyKeyHandler)
+	rt.handle("/audit", c.AuditHandler, get)
+
+	rt.public("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondWithError(w, "Not found", http.StatusNotFound)
+	}))
+}
+
+//protect требует API ключ и записывает запрос в журнал аудита
+func (c *Controller) protect(handler http.HandlerFunc) http.Handler {
+	return c.Audit(c.Authenticate(handler))
+}
+
+//withSeller передает обработчику seller_id из пути
+func (c *Controller) withSeller(handler func(w http.ResponseWriter, r *http.Request, sellerID int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sellerID, ok := pathInt(w, r, "seller_id"); ok {
+			handler(w, r, int(sellerID))
+		}
+	}
+}
+
+//withOffer передает обработчику seller_id и offer_id из пути
+func (c *Controller) withOffer(handler func(w http.ResponseWriter, r *http.Request, sellerID int, offerID int)) http.HandlerFunc {
+	return c.withSeller(func(w http.ResponseWriter, r *http.Request, sellerID int) {
+		if offerID, ok := pathInt(w, r, "offer_id"); ok {
+			handler(w, r, sellerID, int(offerID))
+		}
+	})
+}
+
+//legacyKeyHandler обработка /keys/{key_id} и /keys/{key_id}:rotate.
+//Параметр пути ServeMux занимает весь сегмент, поэтому суффикс :rotate отделяется здесь
+func (c *Controller) legacyKeyHandler(w http.ResponseWriter, r *http.Request) {
+	value, rotate := strings.CutSuffix(r.PathValue("key_id"), ":rotate")
+	keyID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		respondWithError(w, "incorrect key_id", http.StatusBadRequest)
+		return
+	}
+	c.keyHandler(w, r, keyID, rotate)
+}
+
+//withKey передает обработчику ключа key_id из пути
+func (c *Controller) withKey(rotate bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if keyID, ok := pathInt(w, r, "key_id"); ok {
+			c.keyHandler(w, r, keyID, rotate)
+		}
+	}
+}
+
+//pathInt читает числовой параметр пути name, на неверное значение отвечает 400
+func pathInt(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	value, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil {
+		respondWithError(w, "incorrect "+name, http.StatusBadRequest)
+		return 0, false
+	}
+	return value, true
+}
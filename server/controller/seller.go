@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+func validateSeller(s store.Seller) error {
+	if s.ID <= 0 {
+		return &parser.FieldError{Field: "id", Message: "id must be positive"}
+	}
+	if s.Email != "" {
+		if _, err := mail.ParseAddress(s.Email); err != nil {
+			return &parser.FieldError{Field: "email", Message: "email is incorrect"}
+		}
+	}
+	if s.Status != store.SellerActive && s.Status != store.SellerSuspended {
+		return &parser.FieldError{Field: "status", Message: fmt.Sprintf("status must be %q or %q", store.SellerActive, store.SellerSuspended)}
+	}
+	return nil
+}
+
+func (c *Controller) sellersCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.listSellers(w, r)
+	case http.MethodPost:
+		if !authorize(r, 0, actionManage) {
+			respondForbidden(w)
+			return
+		}
+		c.createSeller(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *Controller) sellerHandler(w http.ResponseWriter, r *http.Request, sellerID int) {
+	switch r.Method {
+	case http.MethodGet:
+		if !authorize(r, sellerID, actionRead) {
+			respondForbidden(w)
+			return
+		}
+		s, err := c.store.GetSeller(r.Context(), sellerID)
+		if err != nil {
+			respondWithStoreError(w, r, err, "seller not found")
+			return
+		}
+		respondWithJSON(w, s, http.StatusOK)
+	case http.MethodPatch:
+		if !authorize(r, sellerID, actionManage) {
+			respondForbidden(w)
+			return
+		}
+		c.patchSeller(w, r, sellerID)
+	case http.MethodDelete:
+		if !authorize(r, sellerID, actionManage) {
+			respondForbidden(w)
+			return
+		}
+		if err := c.store.DeleteSeller(r.Context(), sellerID); err != nil {
+			respondWithStoreError(w, r, err, "seller not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *Controller) listSellers(w http.ResponseWriter, r *http.Request) {
+	sellerID, _ := ownSeller(r)
+	if !authorize(r, sellerID, actionRead) {
+		respondForbidden(w)
+		return
+	}
+	sellers, err := c.store.ListSellers(r.Context(), sellerID)
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	respondWithJSON(w, sellers, http.StatusOK)
+}
+
+func (c *Controller) createSeller(w http.ResponseWriter, r *http.Request) {
+	input := api.SellerInput{Status: store.SellerActive}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondWithError(w, "incorrect request body", http.StatusBadRequest)
+		return
+	}
+	s := store.Seller{ID: input.ID, Name: input.Name, Email: input.Email, Status: input.Status}
+	if err := validateSeller(s); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+	err := c.store.CreateSeller(r.Context(), &s)
+	if err == store.ErrConflict {
+		respondWithError(w, "seller already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	respondWithJSON(w, s, http.StatusCreated)
+}
+
+func (c *Controller) patchSeller(w http.ResponseWriter, r *http.Request, sellerID int) {
+	var patch api.SellerPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		respondWithError(w, "incorrect request body", http.StatusBadRequest)
+		return
+	}
+	s, err := c.store.GetSeller(r.Context(), sellerID)
+	if err != nil {
+		respondWithStoreError(w, r, err, "seller not found")
+		return
+	}
+	if patch.Name != nil {
+		s.Name = *patch.Name
+	}
+	if patch.Email != nil {
+		s.Email = *patch.Email
+	}
+	if patch.Status != nil {
+		s.Status = *patch.Status
+	}
+	if err := validateSeller(*s); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+	if err := c.store.UpdateSeller(r.Context(), *s); err != nil {
+		respondWithStoreError(w, r, err, "seller not found")
+		return
+	}
+	respondWithJSON(w, s, http.StatusOK)
+}
+
+//ensureSeller проверяет, что продавец может загружать товары.
+//Неизвестный продавец создается, если это разрешено ImplicitSellers, иначе запрос отклоняется
+func (c *Controller) ensureSeller(w http.ResponseWriter, r *http.Request, sellerID int) bool {
+	s, err := c.store.GetSeller(r.Context(), sellerID)
+	if err == store.ErrNotFound {
+		if !c.ImplicitSellers {
+			respondWithError(w, "seller not found", http.StatusNotFound)
+			return false
+		}
+		err = c.store.CreateSeller(r.Context(), &store.Seller{ID: sellerID})
+		if err == nil || err == store.ErrConflict {
+			return true
+		}
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return false
+	}
+	if s.Status == store.SellerSuspended {
+		respondWithError(w, "seller is suspended", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+//activeSeller проверяет перед изменением или удалением товара, что продавец не приостановлен.
+//Неизвестный продавец не создается: товаров у него нет, и ответ 404
+func (c *Controller) activeSeller(w http.ResponseWriter, r *http.Request, sellerID int) bool {
+	s, err := c.store.GetSeller(r.Context(), sellerID)
+	if err != nil {
+		respondWithStoreError(w, r, err, "offer not found")
+		return false
+	}
+	if s.Status == store.SellerSuspended {
+		respondWithError(w, "seller is suspended", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func respondWithJSON(w http.ResponseWriter, data interface{}, statusCode int) {
+	jData, err := json.Marshal(data)
+	if err != nil {
+		respondWithError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(jData)
+}
+
+//respondWithStoreError отвечает 404 с текстом notFound на store.ErrNotFound, на остальные ошибки хранилища 503
+func respondWithStoreError(w http.ResponseWriter, r *http.Request, err error, notFound string) {
+	if err == store.ErrNotFound && notFound != "" {
+		respondWithError(w, notFound, http.StatusNotFound)
+		return
+	}
+	slog.ErrorContext(r.Context(), "store error", "err", err)
+	respondWithError(w, "Service unavailable", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/goserg/Golang-merchant-API/metrics"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+//errTaskCanceled причина отмены контекста импорта, отмененного по запросу
+var errTaskCanceled = errors.New("task is canceled")
+
+//runningImport выполняемый импорт: cancel отменяет его, done закрывается после окончания
+type runningImport struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+//runImport выполняет импорт run задачи logID сразу или, если async, в фоне так, чтобы Shutdown дождался его окончания.
+//Контекст импорта несет значения reqCtx (ID запроса для журнала), но не отменяется вместе с запросом,
+//а отменяется, когда Shutdown прерывает импорты или задачу отменяют через cancelImport.
+//После начала остановки новый импорт получает отмененный контекст и сразу возвращает задачу в очередь.
+//Паника в импорте завершает задачу с ошибкой
+func (c *Controller) runImport(reqCtx context.Context, async bool, logID int64, run func(ctx context.Context)) {
+	run = c.recoverImport(logID, run)
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(reqCtx))
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		cancel(nil)
+		run(ctx)
+		return
+	}
+	c.imports.Add(1)
+	if c.running == nil {
+		c.running = make(map[int64]*runningImport)
+	}
+	running := &runningImport{cancel: cancel, done: make(chan struct{})}
+	c.running[logID] = running
+	c.mu.Unlock()
+
+	stop := context.AfterFunc(c.importsCtx, func() { cancel(nil) })
+	do := func() {
+		defer c.imports.Done()
+		defer func() {
+			c.mu.Lock()
+			delete(c.running, logID)
+			c.mu.Unlock()
+			close(running.done)
+		}()
+		defer cancel(nil)
+		defer stop()
+		run(ctx)
+	}
+	if !async {
+		do()
+		return
+	}
+	go do()
+}
+
+//cancelImport отменяет импорт задачи logID, если он выполняется на этом сервере, и ждет его окончания или отмены ctx
+func (c *Controller) cancelImport(ctx context.Context, logID int64) bool {
+	c.mu.Lock()
+	running, ok := c.running[logID]
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+	running.cancel(errTaskCanceled)
+	select {
+	case <-running.done:
+	case <-ctx.Done():
+	}
+	return true
+}
+
+//interrupted записывает итог импорта, прерванного отменой ctx: отмененный по запросу импорт получает статус store.TaskCanceled,
+//прерванный остановкой сервера возвращается в очередь, если requeue, или завершается с ошибкой, если данные импорта были только в памяти
+func (c *Controller) interrupted(ctx context.Context, logID int64, numberOfErrors int, requeue bool) {
+	switch {
+	case context.Cause(ctx) == errTaskCanceled:
+		slog.InfoContext(ctx, "import canceled")
+		c.updateTaskLog(context.WithoutCancel(ctx), store.Task{ID: logID, Status: store.TaskCanceled, Errors: numberOfErrors})
+		metrics.ImportDone("canceled")
+	case requeue:
+		c.requeue(ctx, logID)
+	default:
+		c.failTask(ctx, logID, "ERROR: Import interrupted by shutdown", numberOfErrors)
+	}
+}
+
+//requeue возвращает задачу в очередь, чтобы повторить импорт при следующем запуске
+func (c *Controller) requeue(ctx context.Context, logID int64) {
+	slog.InfoContext(ctx, "import interrupted, task is queued")
+	c.updateTaskLog(context.WithoutCancel(ctx), store.Task{ID: logID, Status: store.TaskQueued})
+	metrics.ImportDone("queued")
+}
+
+//QueueDepth число импортов, ждущих свободного места в пуле
+func (c *Controller) QueueDepth() int {
+	return int(c.waiting.Load())
+}
+
+//ActiveImports число выполняемых импортов
+func (c *Controller) ActiveImports() int {
+	return len(c.workers)
+}
+
+//Shutdown ждет окончания импортов. Если ctx истекает раньше, импорты прерываются:
+//обычные загрузки по URL возвращаются в очередь (статус store.TaskQueued), остальные завершаются с ошибкой.
+//Вызывается после остановки HTTP сервера
+func (c *Controller) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	c.closing = true
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.imports.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	c.cancelImports()
+	<-done
+	return ctx.Err()
+}
+
+//ResumeImports запускает импорты, прерванные предыдущей остановкой сервера.
+//Задача запускается, только если этот сервер забрал ее из очереди первым
+func (c *Controller) ResumeImports(ctx context.Context) error {
+	tasks, err := c.store.ListTasks(ctx, store.TaskFilter{Status: store.TaskQueued})
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		claimed, err := c.store.ClaimTask(ctx, task.ID)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		slog.InfoContext(ctx, "import resumed", "task_id", task.ID, "seller_id", task.SellerID)
+		c.runImport(ctx, true, task.ID, func(ctx context.Context) { c.process(ctx, task.URL, task.SellerID, task.ID, importOptions{}) })
+	}
+	return nil
+}
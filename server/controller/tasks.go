@@ -0,0 +1,479 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/logging"
+	"github.com/goserg/Golang-merchant-API/metrics"
+	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+//tasksHandler обработка запросов GET /v1/tasks?seller_id=&status=: задачи по возрастанию ID.
+//Ключ продавца без seller_id получает задачи своего продавца
+func (c *Controller) tasksHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := store.TaskFilter{Status: query.Get("status")}
+	if value := query.Get("seller_id"); value != "" {
+		var err error
+		if filter.SellerID, err = strconv.Atoi(value); err != nil {
+			respondWithError(w, "incorrect seller_id", http.StatusBadRequest)
+			return
+		}
+	}
+	if own, ok := ownSeller(r); ok && filter.SellerID == 0 {
+		filter.SellerID = own
+	}
+	if !authorize(r, filter.SellerID, actionTaskRead) {
+		respondForbidden(w)
+		return
+	}
+	tasks, err := c.store.ListTasks(r.Context(), filter)
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	resp := make([]api.Task, 0, len(tasks))
+	for _, task := range tasks {
+		resp = append(resp, taskResponse(task))
+	}
+	respondWithJSON(w, resp, http.StatusOK)
+}
+
+//cancelTaskHandler обработка запросов POST /v1/tasks/{task_id}/cancel.
+//Выполняемый импорт прерывается, задача в очереди больше не будет повторена. Отвечает итогом задачи
+func (c *Controller) cancelTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := c.readTask(w, r, actionIngest)
+	if !ok {
+		return
+	}
+	taskID := task.ID
+	switch {
+	case c.cancelImport(r.Context(), taskID):
+	case task.Status == store.TaskQueued:
+		task.Status = store.TaskCanceled
+		if err := c.store.UpdateTask(r.Context(), *task); err != nil {
+			respondWithStoreError(w, r, err, "")
+			return
+		}
+	case task.Status == store.TaskProcessing:
+		respondWithError(w, "task is running on another server", http.StatusConflict)
+		return
+	default:
+		respondWithError(w, "task is finished", http.StatusConflict)
+		return
+	}
+	c.provideInfo(taskID, w, r)
+}
+
+//readTask читает задачу task_id из пути. Задача, которую ключ не может читать, не отличается от несуществующей,
+//а если ключ может читать задачу, но не может выполнить act с товарами ее продавца, ответ 403
+func (c *Controller) readTask(w http.ResponseWriter, r *http.Request, act action) (*store.Task, bool) {
+	return c.readTaskParam(w, r, "task_id", act)
+}
+
+//readTaskParam как readTask, но ID задачи берется из параметра пути name
+func (c *Controller) readTaskParam(w http.ResponseWriter, r *http.Request, name string, act action) (*store.Task, bool) {
+	taskID, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil {
+		respondWithError(w, "incorrect "+name, http.StatusNotFound)
+		return nil, false
+	}
+	task, err := c.store.GetTask(r.Context(), taskID)
+	if err == nil && !authorize(r, task.SellerID, actionTaskRead) {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err, "incorrect "+name)
+		return nil, false
+	}
+	if !authorize(r, task.SellerID, act) {
+		respondForbidden(w)
+		return nil, false
+	}
+	return task, true
+}
+
+//Размер страницы изменений пробного импорта и разницы задач
+const (
+	defaultPreviewLimit = 100
+	maxPreviewLimit     = 1000
+)
+
+//previewHandler обработка запросов GET /v1/tasks/{task_id}/preview?offset=&limit=: изменения пробного импорта
+//по возрастанию ID товара. Изменения остаются доступны и после применения
+func (c *Controller) previewHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := c.readTask(w, r, actionTaskRead)
+	if !ok {
+		return
+	}
+	if task.Status != store.TaskPreview && task.Status != store.TaskApplied {
+		respondWithError(w, "task is not a dry run", http.StatusNotFound)
+		return
+	}
+	offset, limit, ok := pageQuery(w, r)
+	if !ok {
+		return
+	}
+	diffs, err := c.store.ListPreview(r.Context(), task.ID, offset, limit)
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	preview := api.Preview{
+		TaskID:  task.ID,
+		Status:  task.Status,
+		Total:   task.NewOffers + task.UpdatedOffers + task.DeletedOffers,
+		Offset:  offset,
+		Limit:   limit,
+		Changes: make([]api.PreviewChange, 0, len(diffs)),
+	}
+	for _, d := range diffs {
+		preview.Changes = append(preview.Changes, previewChange(d))
+	}
+	respondWithJSON(w, preview, http.StatusOK)
+}
+
+//pageQuery читает параметры страницы изменений ?offset=&limit=, на неверные отвечает 400
+func pageQuery(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	query := r.URL.Query()
+	offset, limit := 0, defaultPreviewLimit
+	var errs []api.FieldError
+	if value := query.Get("offset"); value != "" {
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			errs = append(errs, api.FieldError{Field: "offset", Message: "offset must be a non-negative integer"})
+		} else {
+			offset = n
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > maxPreviewLimit {
+			errs = append(errs, api.FieldError{Field: "limit", Message: fmt.Sprintf("limit must be between 1 and %d", maxPreviewLimit)})
+		} else {
+			limit = n
+		}
+	}
+	if len(errs) > 0 {
+		respondWithDetails(w, errs[0].Message, http.StatusBadRequest, errs)
+		return 0, 0, false
+	}
+	return offset, limit, true
+}
+
+//previewChange изменение товара для ответа API
+func previewChange(d store.OfferDiff) api.PreviewChange {
+	action, fields := offerChange(d.Old, d.New)
+	return api.PreviewChange{Action: action, OfferID: d.OfferID, Old: d.Old, New: d.New, Fields: fields}
+}
+
+//offerChange действие, которое меняет товар old на next, и измененные поля обновляемого товара
+func offerChange(old, next *parser.Offer) (string, []api.FieldChange) {
+	switch {
+	case old == nil:
+		return api.ActionInsert, nil
+	case next == nil:
+		return api.ActionDelete, nil
+	}
+	var fields []api.FieldChange
+	for _, f := range []api.FieldChange{
+		{Field: "name", Old: old.Name, New: next.Name},
+		{Field: "price", Old: old.Price, New: next.Price},
+		{Field: "quantity", Old: old.Quantity, New: next.Quantity},
+		{Field: "available", Old: old.Available, New: next.Available},
+	} {
+		if f.Old != f.New {
+			fields = append(fields, f)
+		}
+	}
+	return api.ActionUpdate, fields
+}
+
+//applyTaskHandler обработка запросов POST /v1/tasks/{task_id}/apply: записывает изменения пробного импорта
+//одной транзакцией и отвечает задачей в статусе store.TaskApplied.
+//Если товары продавца изменились после пробного импорта, ничего не записывается и ответ 409
+func (c *Controller) applyTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := c.readTask(w, r, actionIngest)
+	if !ok {
+		return
+	}
+	if task.Status != store.TaskPreview {
+		respondWithError(w, "task is not a dry run waiting to be applied", http.StatusConflict)
+		return
+	}
+	diffs, err := c.store.ListPreview(r.Context(), task.ID, 0, 0)
+	if err == nil {
+		err = c.store.ApplyOfferDiffs(r.Context(), task.SellerID, task.ID, diffs)
+	}
+	if err == store.ErrChanged {
+		respondWithError(w, "offers changed after the dry run, run it again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, r, err, "seller not found")
+		return
+	}
+	task.Status = store.TaskApplied
+	if err := c.store.UpdateTask(r.Context(), *task); err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	slog.InfoContext(r.Context(), "dry run applied", "task_id", task.ID, "seller_id", task.SellerID,
+		"new_offers", task.NewOffers, "updated_offers", task.UpdatedOffers, "deleted_offers", task.DeletedOffers)
+	c.provideInfo(task.ID, w, r)
+}
+
+//revertTaskHandler обработка запросов POST /v1/tasks/{task_id}/revert?force=: возвращает товары, которые добавила,
+//изменила или удалила задача, в состояние до нее. Отмена записывается одной транзакцией как новая задача
+//со своими счетчиками, отмененная задача получает статус store.TaskReverted.
+//Если товары задачи изменились после нее, ничего не записывается и ответ 409 со списком товаров в details,
+//с force=true эти изменения тоже отменяются
+func (c *Controller) revertTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := c.readTask(w, r, actionIngest)
+	if !ok {
+		return
+	}
+	var force bool
+	if value := r.URL.Query().Get("force"); value != "" {
+		var err error
+		if force, err = strconv.ParseBool(value); err != nil {
+			respondWithError(w, "incorrect force", http.StatusBadRequest)
+			return
+		}
+	}
+	switch task.Status {
+	case store.TaskProcessing, store.TaskQueued:
+		respondWithError(w, "task is not finished yet", http.StatusConflict)
+		return
+	case store.TaskPreview:
+		respondWithError(w, "dry run has no changes to revert", http.StatusConflict)
+		return
+	case store.TaskReverted:
+		respondWithError(w, "task is already reverted", http.StatusConflict)
+		return
+	}
+	start := time.Now()
+	diffs, conflicts, err := c.revertDiffs(r, task)
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	if diffs == nil && conflicts == nil {
+		respondWithError(w, "task has no recorded offer changes", http.StatusConflict)
+		return
+	}
+	if len(conflicts) > 0 && !force {
+		respondWithDetails(w, "offers changed after the task, revert with force=true to discard these changes",
+			http.StatusConflict, conflicts)
+		return
+	}
+
+	logID, err := c.store.CreateTask(r.Context(), r.Method+" "+r.URL.Path, task.SellerID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "cannot create task", "err", err)
+		respondWithError(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	ctx := logging.With(r.Context(), "task_id", logID, "seller_id", task.SellerID, "reverted_task_id", task.ID)
+	err = c.store.ApplyOfferDiffs(ctx, task.SellerID, logID, diffs)
+	if err == store.ErrChanged {
+		c.failTask(ctx, logID, "ERROR: Offers changed during revert", 0)
+		respondWithError(w, "offers changed during revert, try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot revert offers", "err", err)
+		c.failTask(ctx, logID, "ERROR: Cannot save offers", 0)
+		respondWithError(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	revert := store.Task{ID: logID, Status: "Finished", ElapsedTime: time.Since(start).String()}
+	revert.NewOffers, revert.UpdatedOffers, revert.DeletedOffers = store.CountDiffs(diffs)
+	c.updateTaskLog(ctx, revert)
+	task.Status = store.TaskReverted
+	c.updateTaskLog(ctx, *task)
+	metrics.ImportDone("reverted")
+	if len(conflicts) > 0 {
+		ids := make([]int, 0, len(conflicts))
+		for _, conflict := range conflicts {
+			ids = append(ids, conflict.OfferID)
+		}
+		slog.WarnContext(ctx, "revert discarded later offer changes", "offer_ids", ids)
+	}
+	slog.InfoContext(ctx, "task reverted", "new_offers", revert.NewOffers, "updated_offers", revert.UpdatedOffers,
+		"deleted_offers", revert.DeletedOffers)
+	c.provideInfo(logID, w, r)
+}
+
+//revertDiffs изменения, которые возвращают товары задачи в состояние до нее, по возрастанию ID товара,
+//и товары, измененные после задачи. Оба результата nil, если у задачи нет записанных изменений
+func (c *Controller) revertDiffs(r *http.Request, task *store.Task) ([]store.OfferDiff, []api.RevertConflict, error) {
+	events, err := c.store.TaskHistory(r.Context(), task.ID)
+	if err != nil || len(events) == 0 {
+		return nil, nil, err
+	}
+	current, err := c.store.SearchOffers(r.Context(), store.OfferSearch{SellerID: task.SellerID})
+	if err != nil {
+		return nil, nil, err
+	}
+	offers := make(map[int]*parser.Offer, len(current))
+	for i := range current {
+		offers[current[i].OfferID] = &current[i]
+	}
+	//состояние товара до задачи и после нее, если задача меняла товар несколько раз
+	before := make(map[int]*parser.Offer)
+	after := make(map[int]*parser.Offer)
+	for _, e := range events {
+		if _, ok := after[e.OfferID]; !ok {
+			before[e.OfferID] = e.Old
+		}
+		after[e.OfferID] = e.New
+	}
+	ids := make([]int, 0, len(after))
+	for id := range after {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	diffs := []store.OfferDiff{}
+	conflicts := []api.RevertConflict{}
+	for _, id := range ids {
+		if !sameOffer(offers[id], after[id]) {
+			conflicts = append(conflicts, api.RevertConflict{OfferID: id, Expected: after[id], Current: offers[id]})
+		}
+		if !sameOffer(offers[id], before[id]) {
+			diffs = append(diffs, store.OfferDiff{OfferID: id, Old: offers[id], New: before[id]})
+		}
+	}
+	return diffs, conflicts, nil
+}
+
+//sameOffer равны ли состояния товара, nil означает, что товара нет
+func sameOffer(a, b *parser.Offer) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+//diffTasksHandler обработка запросов GET /v1/tasks/{task_id}/diff/{other_id}?offset=&limit=&format=: разница между
+//товарами продавца после задачи task_id и после задачи other_id по возрастанию ID товара.
+//С format=xlsx все изменения отдаются xlsx файлом, по строке на товар
+func (c *Controller) diffTasksHandler(w http.ResponseWriter, r *http.Request) {
+	from, ok := c.readTaskParam(w, r, "task_id", actionRead)
+	if !ok {
+		return
+	}
+	to, ok := c.readTaskParam(w, r, "other_id", actionRead)
+	if !ok {
+		return
+	}
+	if from.SellerID != to.SellerID {
+		respondWithError(w, "tasks belong to different sellers", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "xlsx" {
+		respondWithError(w, "incorrect format, want json or xlsx", http.StatusBadRequest)
+		return
+	}
+	offset, limit, ok := pageQuery(w, r)
+	if !ok {
+		return
+	}
+	var snapshots [2][]parser.Offer
+	for i, task := range []*store.Task{from, to} {
+		offers, err := c.store.TaskSnapshot(r.Context(), task.SellerID, task.ID)
+		if err != nil {
+			respondWithStoreError(w, r, err, "")
+			return
+		}
+		snapshots[i] = offers
+	}
+	diffs := store.DiffOffers(from.SellerID, snapshots[0], snapshots[1], true)
+	changes := make([]api.PreviewChange, 0, len(diffs))
+	for _, d := range diffs {
+		change := previewChange(d)
+		addDeltas(change.Fields)
+		changes = append(changes, change)
+	}
+	if format == "xlsx" {
+		respondWithDiffExcel(w, r, from.ID, to.ID, changes)
+		return
+	}
+	diff := api.TaskDiff{FromTaskID: from.ID, ToTaskID: to.ID, SellerID: from.SellerID, Offset: offset, Limit: limit}
+	diff.Added, diff.Changed, diff.Removed = store.CountDiffs(diffs)
+	diff.Changes = changes[min(offset, len(changes)):min(offset+limit, len(changes))]
+	respondWithJSON(w, diff, http.StatusOK)
+}
+
+//addDeltas дополняет изменения цены и количества разницей, а цены еще и изменением в процентах.
+//Цены округляются до копеек, проценты до сотых
+func addDeltas(fields []api.FieldChange) {
+	for i := range fields {
+		f := &fields[i]
+		switch f.Field {
+		case "price":
+			old, next := f.Old.(float64), f.New.(float64)
+			delta := round2(next - old)
+			f.Delta = &delta
+			if old != 0 {
+				percent := round2((next - old) / old * 100)
+				f.Percent = &percent
+			}
+		case "quantity":
+			delta := float64(f.New.(int64) - f.Old.(int64))
+			f.Delta = &delta
+		}
+	}
+}
+
+//round2 округляет до сотых
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+//respondWithDiffExcel отвечает xlsx файлом с изменениями changes: старые и новые значения полей,
+//разница цены и количества и изменение цены в процентах
+func respondWithDiffExcel(w http.ResponseWriter, r *http.Request, fromID, toID int64, changes []api.PreviewChange) {
+	header := []string{"offer_id", "action", "old_name", "new_name", "old_price", "new_price", "price_delta", "price_percent",
+		"old_quantity", "new_quantity", "quantity_delta", "old_available", "new_available"}
+	rows := make([][]interface{}, 0, len(changes))
+	for _, change := range changes {
+		row := make([]interface{}, len(header))
+		row[0], row[1] = change.OfferID, change.Action
+		if o := change.Old; o != nil {
+			row[2], row[4], row[8], row[11] = o.Name, o.Price, o.Quantity, o.Available
+		}
+		if o := change.New; o != nil {
+			row[3], row[5], row[9], row[12] = o.Name, o.Price, o.Quantity, o.Available
+		}
+		for _, f := range change.Fields {
+			switch {
+			case f.Field == "price" && f.Delta != nil:
+				row[6] = *f.Delta
+				if f.Percent != nil {
+					row[7] = *f.Percent
+				}
+			case f.Field == "quantity" && f.Delta != nil:
+				row[10] = int64(*f.Delta)
+			}
+		}
+		rows = append(rows, row)
+	}
+	var buf bytes.Buffer
+	if err := parser.WriteTable(&buf, header, rows); err != nil {
+		slog.ErrorContext(r.Context(), "cannot write xlsx file", "err", err)
+		respondWithError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", xlsxType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="diff-%d-%d.xlsx"`, fromID, toID))
+	w.Write(buf.Bytes())
+}
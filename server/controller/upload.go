@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/api"
+	"github.com/goserg/Golang-merchant-API/metrics"
+	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/store"
+	"github.com/goserg/Golang-merchant-API/tracing"
+)
+
+//xlsxType Content-Type xlsx файла
+const xlsxType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+//uploadHandler обработка запросов POST /v1/sellers/{seller_id}/offers с xlsx файлом в теле (Content-Type: xlsxType).
+//Файл разбирается сразу по профилю ?profile= (по умолчанию parser.DefaultProfile),
+//а товары записываются так же, как пакет JSON, в том числе с ?async=, ?dry_run= и ?replace=
+func (c *Controller) uploadHandler(w http.ResponseWriter, r *http.Request, sellerID int) {
+	if !authorize(r, sellerID, actionIngest) {
+		respondForbidden(w)
+		return
+	}
+	async, opts, ok := importQuery(w, r)
+	if !ok {
+		return
+	}
+	data, profile, ok := c.readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	start := time.Now()
+	_, parseSpan := tracing.Start(r.Context(), "parse")
+	f, err := parser.OpenReader(io.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		tracing.End(parseSpan, err)
+		respondWithError(w, "cannot read xlsx file", http.StatusBadRequest)
+		return
+	}
+	offers, rowErrors, err := parser.ParseExcelProfile(f, profile)
+	if err != nil {
+		tracing.End(parseSpan, err)
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	endParse(parseSpan, offers, rowErrors)
+	metrics.ObservePhase(metrics.PhaseParse, start)
+	c.importParsed(w, r, sellerID, async, opts, offers, rowErrors, start)
+}
+
+//validateHandler обработка запросов POST /v1/validate?profile= с xlsx файлом в теле.
+//Проверяет файл так же, как импорт, и отвечает отчетом parser.Report, ничего не записывая в базу
+func (c *Controller) validateHandler(w http.ResponseWriter, r *http.Request) {
+	sellerID, _ := ownSeller(r)
+	if !authorize(r, sellerID, actionIngest) {
+		respondForbidden(w)
+		return
+	}
+	data, profile, ok := c.readUpload(w, r)
+	if !ok {
+		return
+	}
+	f, err := parser.OpenReader(io.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		respondWithError(w, "cannot read xlsx file", http.StatusBadRequest)
+		return
+	}
+	report, err := parser.Lint(f, profile)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respondWithJSON(w, report, http.StatusOK)
+}
+
+//readUpload читает профиль из ?profile= и xlsx файл из тела запроса не больше maxFileBytes.
+//На неверный профиль и слишком большой файл отвечает ошибкой
+func (c *Controller) readUpload(w http.ResponseWriter, r *http.Request) ([]byte, parser.Profile, bool) {
+	profile, err := parser.LookupProfile(r.URL.Query().Get("profile"))
+	if err != nil {
+		respondWithDetails(w, err.Error(), http.StatusBadRequest, []api.FieldError{{Field: "profile", Message: err.Error()}})
+		return nil, profile, false
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, c.maxFileBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, "file is too large", http.StatusRequestEntityTooLarge)
+		return nil, profile, false
+	}
+	if err != nil {
+		respondWithError(w, "incorrect request body", http.StatusBadRequest)
+		return nil, profile, false
+	}
+	return data, profile, true
+}
+
+//exportHandler обработка запросов GET /v1/sellers/{seller_id}/offers:export: все товары продавца в xlsx файле,
+//который можно снова загрузить через POST /v1/sellers/{seller_id}/offers
+func (c *Controller) exportHandler(w http.ResponseWriter, r *http.Request, sellerID int) {
+	if !authorize(r, sellerID, actionRead) {
+		respondForbidden(w)
+		return
+	}
+	if _, err := c.store.GetSeller(r.Context(), sellerID); err != nil {
+		respondWithStoreError(w, r, err, "seller not found")
+		return
+	}
+	offers, err := c.store.SearchOffers(r.Context(), store.OfferSearch{SellerID: sellerID})
+	if err != nil {
+		respondWithStoreError(w, r, err, "")
+		return
+	}
+	var buf bytes.Buffer
+	if err := parser.WriteExcel(&buf, offers); err != nil {
+		slog.ErrorContext(r.Context(), "cannot write xlsx file", "err", err)
+		respondWithError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", xlsxType)
+	w.Header().Set("Content-Disposition", `attachment; filename="offers-`+strconv.Itoa(sellerID)+`.xlsx"`)
+	w.Write(buf.Bytes())
+}
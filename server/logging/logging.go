@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type argsKey struct{}
+
+type requestIDKey struct{}
+
+//With возвращает контекст, записи журнала в котором получают атрибуты args (пары ключ, значение или slog.Attr).
+//Записи нужно делать функциями *Context: slog.InfoContext(ctx, ...)
+func With(ctx context.Context, args ...any) context.Context {
+	prev := Args(ctx)
+	next := make([]any, 0, len(prev)+len(args))
+	next = append(next, prev...)
+	next = append(next, args...)
+	return context.WithValue(ctx, argsKey{}, next)
+}
+
+//Args атрибуты журнала из контекста
+func Args(ctx context.Context) []any {
+	args, _ := ctx.Value(argsKey{}).([]any)
+	return args
+}
+
+//WithRequestID сохраняет ID запроса в контексте и добавляет его к записям журнала
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return With(context.WithValue(ctx, requestIDKey{}, id), "request_id", id)
+}
+
+//RequestID ID запроса из контекста или пустая строка
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+//Handler добавляет к записям журнала атрибуты из контекста и ID трассировки
+type Handler struct {
+	slog.Handler
+}
+
+//Handle записывает запись с атрибутами контекста
+func (h Handler) Handle(ctx context.Context, r slog.Record) error {
+	args := Args(ctx)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		args = append(args[:len(args):len(args)], "trace_id", sc.TraceID().String())
+	}
+	if len(args) > 0 {
+		r = r.Clone()
+		r.Add(args...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+//WithAttrs возвращает Handler с атрибутами attrs
+func (h Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return Handler{h.Handler.WithAttrs(attrs)}
+}
+
+//WithGroup возвращает Handler с группой name
+func (h Handler) WithGroup(name string) slog.Handler {
+	return Handler{h.Handler.WithGroup(name)}
+}
+
+//New создает журнал в формате format (json или text) с минимальным уровнем level
+func New(w io.Writer, format string, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if format == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(Handler{handler})
+}
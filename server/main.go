@@ -1,43 +1,207 @@
 package main
 
 import (
+	"github.com/goserg/Golang-merchant-API/config"
 	"github.com/goserg/Golang-merchant-API/controller"
+	"github.com/goserg/Golang-merchant-API/logging"
+	"github.com/goserg/Golang-merchant-API/metrics"
+	"github.com/goserg/Golang-merchant-API/migrate"
+	"github.com/goserg/Golang-merchant-API/store"
+	"github.com/goserg/Golang-merchant-API/store/memory"
+	"github.com/goserg/Golang-merchant-API/store/postgres"
+	"github.com/goserg/Golang-merchant-API/store/sqlite"
+	"github.com/goserg/Golang-merchant-API/tracing"
 
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq"
-)
-
-const (
-	user     = "postgres"
-	password = "pass"
-	host     = "db"
-	port     = 5432
-	dbname   = "postgres"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func main() {
-	db, err := sql.Open("postgres", fmt.Sprintf("postgres://%v:%v@%v:%v/%v?sslmode=disable",
-		user,
-		password,
-		host,
-		port,
-		dbname))
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	level, _ := cfg.Level()
+	slog.SetDefault(logging.New(os.Stderr, cfg.LogFormat, level))
+
+	if len(args) > 0 && args[0] == "config" {
+		fmt.Print(cfg)
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Endpoint, cfg.Tracing.SampleRatio)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
+	}
+
+	var s store.Store
+	var migrator *migrate.Migrator
+	switch cfg.Store {
+	case "postgres":
+		db, openErr := sql.Open("postgres", cfg.DatabaseURL)
+		if openErr != nil {
+			log.Fatal(openErr)
+		}
+		waitForDB(db)
+		metrics.RegisterDB(db)
+		s = postgres.New(db)
+		migrator, err = postgres.Migrator(db)
+	case "sqlite":
+		sqliteStore, openErr := sqlite.Open(cfg.SQLitePath)
+		if openErr != nil {
+			log.Fatal(openErr)
+		}
+		s = sqliteStore
+		metrics.RegisterDB(sqliteStore.DB())
+		migrator, err = sqlite.Migrator(sqliteStore.DB())
+	case "memory":
+		s = memory.New()
+	}
+	defer s.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(migrator, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if migrator != nil {
+		if cfg.Migrate {
+			versions, err := migrator.Up(context.Background())
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(versions) > 0 {
+				slog.Info("applied migrations", "versions", versions)
+			}
+		} else if err := migrator.Verify(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	controller := controller.NewController(s)
+	controller.ImplicitSellers = cfg.ImplicitSellers
+	controller.SetAdminKey(cfg.AdminKey)
+	controller.SetImportLimits(cfg.Workers, cfg.Fetch.Timeout, cfg.Fetch.MaxBytes)
+	controller.MaxQueue = cfg.MaxQueue
+	if migrator != nil {
+		controller.Schema = migrator
+	}
+
+	//wrap добавляет к каждому маршруту метрики запросов, трассировку, ID запроса и восстановление после паники.
+	//Маршрут в метриках и имени спана равен шаблону пути
+	wrap := func(pattern string, handler http.Handler) http.Handler {
+		traced := otelhttp.NewHandler(controller.RequestID(controller.Recover(handler)), pattern,
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method + " " + pattern }))
+		return metrics.Instrument(pattern, traced)
+	}
+	mux := http.NewServeMux()
+	controller.Routes(mux, wrap)
+	mux.Handle("/metrics", metrics.Handler())
+	metrics.RegisterPool(controller)
+
+	if err := controller.ResumeImports(context.Background()); err != nil {
+		log.Fatal(err)
 	}
-	defer db.Close()
 
-	controller := controller.NewController(db)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: cfg.Listen, Handler: mux}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	slog.Info("API started", "listen", cfg.Listen, "store", cfg.Store)
+
+	select {
+	case err := <-serverErr:
+		slog.Error("server failed", "err", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	stop()
 
-	http.HandleFunc("/", controller.HomePage)
-	http.HandleFunc("/offers", controller.OffersHandler)
-	http.HandleFunc("/info", controller.InfoHandler)
+	//новые запросы не принимаются, текущие запросы и импорты получают shutdown_timeout на завершение
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("requests interrupted by shutdown", "err", err)
+	}
+	if err := controller.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("imports interrupted by shutdown, their tasks are queued", "err", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("cannot export traces", "err", err)
+	}
+	slog.Info("API stopped")
+}
 
-	fmt.Println("API started.")
+//waitForDB ждет запуска базы данных, например, при одновременном старте контейнеров
+func waitForDB(db *sql.DB) {
+	for i := 0; i < 30; i++ {
+		if err := db.Ping(); err == nil {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
 
-	log.Fatal(http.ListenAndServe(":8000", nil))
+//runMigrate выполняет подкоманду migrate: up, down [N] (по умолчанию 1) или status
+func runMigrate(migrator *migrate.Migrator, args []string) error {
+	if migrator == nil {
+		return fmt.Errorf("store has no schema to migrate")
+	}
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "up":
+		versions, err := migrator.Up(ctx)
+		fmt.Println("Applied migrations:", versions)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("incorrect number of migrations %q", args[1])
+			}
+		}
+		versions, err := migrator.Down(ctx, steps)
+		fmt.Println("Reverted migrations:", versions)
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+	return fmt.Errorf("unknown migrate command %q", command)
 }
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//Фазы импорта
+const (
+	PhaseDownload = "download"
+	PhaseParse    = "parse"
+	PhaseWrite    = "write"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "merchant_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "merchant_http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	importPhaseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "merchant_import_phase_duration_seconds",
+		Help:    "Duration of import phases: download, parse and write.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"phase"})
+
+	importRowsPerSecond = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "merchant_import_rows_per_second",
+		Help:    "Import throughput: parsed rows per second from parsing to the end of writing.",
+		Buckets: prometheus.ExponentialBuckets(10, 4, 9),
+	})
+
+	importRowErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "merchant_import_row_errors_total",
+		Help: "Rows skipped during import by reason.",
+	}, []string{"reason"})
+
+	imports = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "merchant_imports_total",
+		Help: "Finished imports by result: finished, failed, queued, canceled, preview or reverted.",
+	}, []string{"result"})
+)
+
+//Handler отдает метрики в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+//Instrument считает запросы к обработчику маршрута route и время их обработки
+func Instrument(route string, handler http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+	return promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels), handler))
+}
+
+//ObservePhase записывает длительность фазы импорта, начатой в start
+func ObservePhase(phase string, start time.Time) {
+	importPhaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+}
+
+//ObserveRows записывает скорость импорта rows строк за время elapsed
+func ObserveRows(rows int, elapsed time.Duration) {
+	if elapsed > 0 {
+		importRowsPerSecond.Observe(float64(rows) / elapsed.Seconds())
+	}
+}
+
+//AddRowErrors учитывает отброшенные строки по причинам
+func AddRowErrors(reasons map[string]int) {
+	for reason, n := range reasons {
+		importRowErrors.WithLabelValues(reason).Add(float64(n))
+	}
+}
+
+//ImportDone учитывает завершенный импорт
+func ImportDone(result string) {
+	imports.WithLabelValues(result).Inc()
+}
+
+//Pool состояние пула импортов
+type Pool interface {
+	//QueueDepth число импортов, ждущих свободного места в пуле
+	QueueDepth() int
+	//ActiveImports число выполняемых импортов
+	ActiveImports() int
+}
+
+//RegisterPool добавляет метрики очереди и пула импортов. Вызывается один раз при запуске
+func RegisterPool(pool Pool) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "merchant_import_queue_depth",
+			Help: "Imports waiting for a free worker.",
+		}, func() float64 { return float64(pool.QueueDepth()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "merchant_import_active_workers",
+			Help: "Workers running an import.",
+		}, func() float64 { return float64(pool.ActiveImports()) }),
+	)
+}
+
+//RegisterDB добавляет метрики пула соединений базы данных. Вызывается один раз при запуске
+func RegisterDB(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "merchant"))
+}
@@ -0,0 +1,275 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//fileName имя файла миграции: 0001_init.up.sql или 0001_init.down.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+//Migration версия схемы. Down пустой, если откат не поддерживается
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+//Status состояние миграции в базе. AppliedAt равен nil, если миграция не применена
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+//Migrator применяет и откатывает миграции, записывая версии в таблицу schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	lock       string
+}
+
+//New загружает миграции из корня fsys.
+//lock выполняется в начале транзакции каждой миграции, чтобы несколько серверов не применяли ее одновременно
+func New(db *sql.DB, fsys fs.FS, lock string) (*Migrator, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		match := fileName.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(fsys, file.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+			sum := sha256.Sum256(data)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(data)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return &Migrator{db, migrations, lock}, nil
+}
+
+//Migrations возвращает известные миграции по возрастанию версии
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) applied(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}) (map[int]appliedMigration, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) init(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at timestamp NOT NULL
+	)`)
+	return err
+}
+
+//Verify проверяет, что все примененные миграции известны серверу и не изменились после применения
+func (m *Migrator) Verify(ctx context.Context) error {
+	if err := m.init(ctx); err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return err
+	}
+	return m.verify(applied)
+}
+
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	known := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for version, a := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("migration %d is applied but unknown to this server, the schema is newer", version)
+		}
+		if migration.Checksum != a.checksum {
+			return fmt.Errorf("migration %d_%s was changed after it was applied: checksum mismatch", version, migration.Name)
+		}
+	}
+	return nil
+}
+
+//Status возвращает состояние всех известных миграций
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.Verify(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if a, ok := applied[migration.Version]; ok {
+			appliedAt := a.appliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+//Up применяет все непримененные миграции по возрастанию версии, каждую в своей транзакции.
+//Возвращает версии примененных миграций
+func (m *Migrator) Up(ctx context.Context) ([]int, error) {
+	if err := m.Verify(ctx); err != nil {
+		return nil, err
+	}
+	var done []int
+	for _, migration := range m.migrations {
+		ok, err := m.apply(ctx, migration)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		if ok {
+			done = append(done, migration.Version)
+		}
+	}
+	return done, nil
+}
+
+//apply применяет миграцию, если за время ожидания блокировки ее не применил другой сервер
+func (m *Migrator) apply(ctx context.Context, migration Migration) (bool, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if m.lock != "" {
+		if _, err := tx.ExecContext(ctx, m.lock); err != nil {
+			return false, err
+		}
+	}
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := applied[migration.Version]; ok {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES($1, $2, $3, $4)`,
+		migration.Version, migration.Name, migration.Checksum, time.Now().UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+//Down откатывает steps последних примененных миграций. Возвращает версии откаченных миграций
+func (m *Migrator) Down(ctx context.Context, steps int) ([]int, error) {
+	if err := m.Verify(ctx); err != nil {
+		return nil, err
+	}
+	var done []int
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		ok, err := m.revert(ctx, migration)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		if ok {
+			done = append(done, migration.Version)
+		}
+	}
+	return done, nil
+}
+
+func (m *Migrator) revert(ctx context.Context, migration Migration) (bool, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if m.lock != "" {
+		if _, err := tx.ExecContext(ctx, m.lock); err != nil {
+			return false, err
+		}
+	}
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := applied[migration.Version]; !ok {
+		return false, nil
+	}
+	if migration.Down == "" {
+		return false, fmt.Errorf("no down migration")
+	}
+	if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version=$1`, migration.Version); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
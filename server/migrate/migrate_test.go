@@ -0,0 +1,115 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_seller.up.sql":   {Data: []byte(`CREATE TABLE seller (id integer PRIMARY KEY);`)},
+		"0001_seller.down.sql": {Data: []byte(`DROP TABLE seller;`)},
+		"0002_offer.up.sql":    {Data: []byte(`CREATE TABLE offer (id integer PRIMARY KEY);`)},
+		"0002_offer.down.sql":  {Data: []byte(`DROP TABLE offer;`)},
+		"README.md":            {Data: []byte(`not a migration`)},
+	}
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var n int
+	err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type='table' AND name=$1`, name).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m, err := New(db, testMigrations(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := m.Up(ctx)
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("up applied %v, %v, want [1 2]", versions, err)
+	}
+	if !tableExists(t, db, "seller") || !tableExists(t, db, "offer") {
+		t.Fatal("tables are not created")
+	}
+	if versions, err := m.Up(ctx); err != nil || len(versions) != 0 {
+		t.Fatalf("second up applied %v, %v, want nothing", versions, err)
+	}
+
+	versions, err = m.Down(ctx, 1)
+	if err != nil || len(versions) != 1 || versions[0] != 2 {
+		t.Fatalf("down reverted %v, %v, want [2]", versions, err)
+	}
+	if tableExists(t, db, "offer") || !tableExists(t, db, "seller") {
+		t.Fatal("down reverted wrong migration")
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Errorf("unexpected status %+v", statuses)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m, _ := New(db, testMigrations(), "")
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := testMigrations()
+	changed["0001_seller.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE seller (id integer PRIMARY KEY, name text);`)}
+	m, _ = New(db, changed, "")
+	if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("up with changed migration returned %v, want checksum mismatch", err)
+	}
+
+	older := testMigrations()
+	delete(older, "0002_offer.up.sql")
+	delete(older, "0002_offer.down.sql")
+	m, _ = New(db, older, "")
+	if err := m.Verify(ctx); err == nil {
+		t.Error("verify accepted a schema newer than the migrations")
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	broken := testMigrations()
+	broken["0002_offer.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE offer (id integer); SELECT * FROM missing;`)}
+	m, _ := New(db, broken, "")
+
+	versions, err := m.Up(ctx)
+	if err == nil || len(versions) != 1 {
+		t.Fatalf("up applied %v, %v, want [1] and an error", versions, err)
+	}
+	if tableExists(t, db, "offer") {
+		t.Error("failed migration was not rolled back")
+	}
+}
@@ -1,6 +1,11 @@
 package parser
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"strconv"
 
@@ -17,49 +22,215 @@ type Offer struct {
 	SellerID  int     `json:"seller_id"`
 }
 
+//Причины ошибок строк
+const (
+	ReasonMalformed        = "malformed"
+	ReasonShortRow         = "short_row"
+	ReasonInvalidOfferID   = "invalid_offer_id"
+	ReasonInvalidName      = "invalid_name"
+	ReasonInvalidPrice     = "invalid_price"
+	ReasonInvalidQuantity  = "invalid_quantity"
+	ReasonInvalidAvailable = "invalid_available"
+)
+
+//RowErrors число отброшенных строк по причинам
+type RowErrors map[string]int
+
+//Add учитывает отброшенную строку
+func (e RowErrors) Add(reason string) {
+	e[reason]++
+}
+
+//Total общее число отброшенных строк
+func (e RowErrors) Total() int {
+	total := 0
+	for _, n := range e {
+		total += n
+	}
+	return total
+}
+
+//FieldError неверное значение поля товара
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+//Reason причина ошибки строки
+func (e *FieldError) Reason() string {
+	return "invalid_" + e.Field
+}
+
+//Validate проверяет товар по правилам импорта: неотрицательные ID, цена и количество, непустое имя.
+//Ошибка имеет тип *FieldError
+func (o Offer) Validate() error {
+	switch {
+	case o.OfferID < 0:
+		return &FieldError{"offer_id", "offer_id must not be negative"}
+	case o.Name == "":
+		return &FieldError{"name", "name must not be empty"}
+	case o.Price < 0:
+		return &FieldError{"price", "price must not be negative"}
+	case o.Quantity < 0:
+		return &FieldError{"quantity", "quantity must not be negative"}
+	}
+	return nil
+}
+
 //OpenReader открывает xlsx файл из тела респонса
 func OpenReader(body io.ReadCloser) (*excelize.File, error) {
 	return excelize.OpenReader(body)
 }
 
-//ParseExcel парсит xlsx файл
-func ParseExcel(file *excelize.File) ([]Offer, int) {
+//ParseExcel парсит xlsx файл по профилю DefaultProfile. Строки листа data: offer_id, name, price, quantity, available.
+//Строки короче пяти ячеек считаются ошибками
+func ParseExcel(file *excelize.File) ([]Offer, RowErrors) {
+	offers, rowErrors, _ := ParseExcelProfile(file, DefaultProfile)
+	return offers, rowErrors
+}
+
+//ParseExcelProfile парсит xlsx файл по профилю profile.
+//Ошибка означает, что файл не подходит профилю целиком: нет листа или колонки
+func ParseExcelProfile(file *excelize.File, profile Profile) ([]Offer, RowErrors, error) {
 	var offers []Offer
-	numberOfErrors := 0
+	rowErrors := RowErrors{}
+	err := profile.each(file, func(_ int, o Offer, rowErr *RowError) {
+		if rowErr != nil {
+			rowErrors.Add(rowErr.Reason)
+			return
+		}
+		offers = append(offers, o)
+	})
+	return offers, rowErrors, err
+}
+
+//parseRow разбирает и проверяет строку листа, index номера ячеек колонок offer_id, name, price, quantity, available
+func parseRow(row []string, index [5]int) (Offer, *RowError) {
+	for _, i := range index {
+		if i >= len(row) {
+			return Offer{}, &RowError{Reason: ReasonShortRow, Message: fmt.Sprintf("row has %d cells, want %d", len(row), i+1)}
+		}
+	}
+	var o Offer
+	offerID, err := strconv.ParseInt(row[index[0]], 10, 64)
+	if err != nil {
+		return o, &RowError{Reason: ReasonInvalidOfferID, Message: fmt.Sprintf("offer_id %q is not an integer", row[index[0]])}
+	}
+	o.OfferID = int(offerID)
+	o.Name = row[index[1]]
+	if o.Price, err = strconv.ParseFloat(row[index[2]], 64); err != nil {
+		return o, &RowError{Reason: ReasonInvalidPrice, Message: fmt.Sprintf("price %q is not a number", row[index[2]])}
+	}
+	if o.Quantity, err = strconv.ParseInt(row[index[3]], 10, 64); err != nil {
+		return o, &RowError{Reason: ReasonInvalidQuantity, Message: fmt.Sprintf("quantity %q is not an integer", row[index[3]])}
+	}
+	if o.Available, err = strconv.ParseBool(row[index[4]]); err != nil {
+		return o, &RowError{Reason: ReasonInvalidAvailable, Message: fmt.Sprintf("available %q is not a boolean", row[index[4]])}
+	}
+	if err := o.Validate(); err != nil {
+		fieldErr := err.(*FieldError)
+		return o, &RowError{Reason: fieldErr.Reason(), Message: fieldErr.Message}
+	}
+	return o, nil
+}
 
-	rows := file.GetRows("data")
+//WriteExcel записывает товары в xlsx файл в формате, который читает ParseExcel
+func WriteExcel(w io.Writer, offers []Offer) error {
+	file := excelize.NewFile()
+	file.SetSheetName("Sheet1", "data")
+	for i, o := range offers {
+		file.SetSheetRow("data", "A"+strconv.Itoa(i+1), &[]interface{}{
+			o.OfferID, o.Name, o.Price, o.Quantity, strconv.FormatBool(o.Available),
+		})
+	}
+	return file.Write(w)
+}
 
-	for _, row := range rows {
-		o := Offer{}
-		offerID, err := strconv.ParseInt(row[0], 10, 64)
-		if err != nil {
-			numberOfErrors++
-			continue
+//WriteTable записывает таблицу с заголовком header в xlsx файл, пустые ячейки передаются как nil
+func WriteTable(w io.Writer, header []string, rows [][]interface{}) error {
+	file := excelize.NewFile()
+	file.SetSheetName("Sheet1", "data")
+	titles := make([]interface{}, len(header))
+	for i, title := range header {
+		titles[i] = title
+	}
+	file.SetSheetRow("data", "A1", &titles)
+	for i, row := range rows {
+		file.SetSheetRow("data", "A"+strconv.Itoa(i+2), &row)
+	}
+	return file.Write(w)
+}
+
+//ParseJSON парсит JSON массив товаров.
+//Элементы, которые не удалось разобрать или не прошедшие проверку, считаются ошибками строк
+func ParseJSON(r io.Reader) ([]Offer, RowErrors, error) {
+	var offers []Offer
+	rowErrors := RowErrors{}
+
+	dec := json.NewDecoder(r)
+	token, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, nil, errors.New("expected JSON array of offers")
+	}
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, nil, err
 		}
-		o.OfferID = int(offerID)
-		o.Name = row[1]
-		o.Price, err = strconv.ParseFloat(row[2], 64)
-		if err != nil {
-			numberOfErrors++
+		o, reason := decodeOffer(raw)
+		if reason != "" {
+			rowErrors.Add(reason)
 			continue
 		}
-		o.Quantity, err = strconv.ParseInt(row[3], 10, 64)
-		if err != nil {
-			numberOfErrors++
+		offers = append(offers, o)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	return offers, rowErrors, nil
+}
+
+//ParseNDJSON парсит поток товаров в формате NDJSON, по одному JSON объекту в строке
+func ParseNDJSON(r io.Reader) ([]Offer, RowErrors, error) {
+	var offers []Offer
+	rowErrors := RowErrors{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
 			continue
 		}
-		o.Available, err = strconv.ParseBool(row[4])
-		if err != nil {
-			numberOfErrors++
+		o, reason := decodeOffer(line)
+		if reason != "" {
+			rowErrors.Add(reason)
 			continue
 		}
+		offers = append(offers, o)
+	}
+	return offers, rowErrors, scanner.Err()
+}
 
-		if o.OfferID < 0 || o.Name == "" || o.Price < 0 || o.Quantity < 0 {
-			numberOfErrors++
-			continue
+//decodeOffer разбирает и проверяет товар, для отброшенного товара возвращает причину
+func decodeOffer(data []byte) (Offer, string) {
+	var o Offer
+	if err := json.Unmarshal(data, &o); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return o, "invalid_" + typeErr.Field
 		}
-
-		offers = append(offers, o)
+		return o, ReasonMalformed
+	}
+	if err := o.Validate(); err != nil {
+		return o, err.(*FieldError).Reason()
 	}
-	return offers, numberOfErrors
+	return o, ""
 }
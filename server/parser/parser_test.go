@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+func TestParseExcelShortRow(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "data")
+	for col, value := range []interface{}{1, "full", 10.5, 3, true} {
+		f.SetCellValue("data", excelize.ToAlphaString(col)+"1", value)
+	}
+	f.SetCellValue("data", "A2", 2)
+	f.SetCellValue("data", "B2", "short")
+
+	//короткие строки дополняются до ширины листа, поэтому короткий лист отдельно
+	short := excelize.NewFile()
+	short.SetSheetName("Sheet1", "data")
+	short.SetCellValue("data", "A1", 3)
+	short.SetCellValue("data", "B1", "short sheet")
+
+	offers, rowErrors := ParseExcel(f)
+	if len(offers) != 1 || offers[0].OfferID != 1 {
+		t.Errorf("unexpected offers %+v", offers)
+	}
+	if rowErrors.Total() != 1 {
+		t.Errorf("unexpected row errors %v", rowErrors)
+	}
+
+	offers, rowErrors = ParseExcel(short)
+	if len(offers) != 0 || rowErrors[ReasonShortRow] != 1 {
+		t.Errorf("short sheet parsed as %+v, %v", offers, rowErrors)
+	}
+}
+
+func TestWriteExcel(t *testing.T) {
+	offers := []Offer{
+		{OfferID: 1, Name: "first", Price: 10.5, Quantity: 3, Available: true},
+		{OfferID: 2, Name: "second", Price: 0, Quantity: 0, Available: false},
+	}
+	var buf bytes.Buffer
+	if err := WriteExcel(&buf, offers); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenReader(io.NopCloser(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, rowErrors := ParseExcel(f)
+	if rowErrors.Total() != 0 || !reflect.DeepEqual(parsed, offers) {
+		t.Errorf("written offers parsed as %+v, %v", parsed, rowErrors)
+	}
+}
+
+func TestLint(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "data")
+	for i, row := range [][]interface{}{
+		{1, "first", 10.5, 3, true},
+		{"x", "bad id", 1, 1, true},
+		{2, "bad price", "free", 1, true},
+		{1, "first again", 11, 3, true},
+	} {
+		f.SetSheetRow("data", "A"+strconv.Itoa(i+1), &row)
+	}
+
+	report, err := Lint(f, DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Rows != 4 || report.Valid != 2 || len(report.Errors) != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(report.Errors) == 2 && (report.Errors[0].Row != 2 || report.Errors[1].Reason != ReasonInvalidPrice) {
+		t.Errorf("unexpected row errors %+v", report.Errors)
+	}
+	if !reflect.DeepEqual(report.Duplicates, []Duplicate{{OfferID: 1, Rows: []int{1, 4}}}) {
+		t.Errorf("unexpected duplicates %+v", report.Duplicates)
+	}
+
+	if _, err := Lint(f, Profile{Name: "other", Sheet: "offers"}); err == nil {
+		t.Error("missing sheet is not an error")
+	}
+	if _, err := Lint(f, profiles["header"]); err == nil {
+		t.Error("sheet without header columns is not an error")
+	}
+	if _, err := LookupProfile("unknown"); err == nil {
+		t.Error("unknown profile found")
+	}
+}
+
+func TestParseExcelHeaderProfile(t *testing.T) {
+	f := excelize.NewFile()
+	for i, row := range [][]interface{}{
+		{"Available", "Price", "Offer_ID", "Comment", "Name", "Quantity"},
+		{"false", 2.5, 7, "ignored", "seven", 4},
+	} {
+		f.SetSheetRow("Sheet1", "A"+strconv.Itoa(i+1), &row)
+	}
+	profile, _ := LookupProfile("header")
+	offers, rowErrors, err := ParseExcelProfile(f, profile)
+	want := []Offer{{OfferID: 7, Name: "seven", Price: 2.5, Quantity: 4, Available: false}}
+	if err != nil || rowErrors.Total() != 0 || !reflect.DeepEqual(offers, want) {
+		t.Errorf("header sheet parsed as %+v, %v, %v", offers, rowErrors, err)
+	}
+}
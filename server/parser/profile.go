@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+//Profile формат xlsx файла с товарами
+type Profile struct {
+	Name string
+	//Sheet лист с товарами, пустой означает первый лист файла
+	Sheet string
+	//Header первая строка листа содержит названия колонок offer_id, name, price, quantity, available
+	//в любом порядке, остальные колонки не читаются. Без Header колонки идут в этом порядке с первой
+	Header bool
+}
+
+//DefaultProfile формат файлов импорта: лист data без заголовка
+var DefaultProfile = Profile{Name: "default", Sheet: "data"}
+
+//profiles известные профили по имени
+var profiles = map[string]Profile{
+	DefaultProfile.Name: DefaultProfile,
+	"header":            {Name: "header", Header: true},
+}
+
+//columns колонки товара в порядке профиля без заголовка
+var columns = [5]string{"offer_id", "name", "price", "quantity", "available"}
+
+//LookupProfile возвращает профиль по имени, пустое имя означает DefaultProfile
+func LookupProfile(name string) (Profile, error) {
+	if name == "" {
+		return DefaultProfile, nil
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q, want one of %s", name, strings.Join(ProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+//ProfileNames имена известных профилей по алфавиту
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//RowError ошибка строки листа: reason как в RowErrors, message для человека
+type RowError struct {
+	Row     int    `json:"row"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+//each вызывает fn для каждой строки товара с номером строки листа, начиная с 1.
+//Для отброшенной строки передается ее ошибка
+func (p Profile) each(file *excelize.File, fn func(row int, o Offer, rowErr *RowError)) error {
+	sheet := p.Sheet
+	if sheet == "" {
+		sheet = file.GetSheetName(1)
+	} else if file.GetSheetIndex(sheet) == 0 {
+		return fmt.Errorf("sheet %q not found", sheet)
+	}
+	rows := file.GetRows(sheet)
+	index := [5]int{0, 1, 2, 3, 4}
+	first := 0
+	if p.Header {
+		if len(rows) == 0 {
+			return fmt.Errorf("sheet %q has no header row", sheet)
+		}
+		found := make(map[string]int)
+		for i, title := range rows[0] {
+			found[strings.ToLower(strings.TrimSpace(title))] = i
+		}
+		for i, column := range columns {
+			n, ok := found[column]
+			if !ok {
+				return fmt.Errorf("header has no column %s", column)
+			}
+			index[i] = n
+		}
+		first = 1
+	}
+	for i := first; i < len(rows); i++ {
+		o, rowErr := parseRow(rows[i], index)
+		if rowErr != nil {
+			rowErr.Row = i + 1
+		}
+		fn(i+1, o, rowErr)
+	}
+	return nil
+}
+
+//Report итог проверки файла без импорта
+type Report struct {
+	Profile string `json:"profile"`
+	//Rows число строк товаров без заголовка
+	Rows   int        `json:"rows"`
+	Valid  int        `json:"valid"`
+	Errors []RowError `json:"errors"`
+	//Duplicates ID товаров, которые встречаются в нескольких правильных строках. При импорте остается последняя строка
+	Duplicates []Duplicate `json:"duplicates"`
+	//Reasons число ошибок по причинам
+	Reasons RowErrors `json:"reasons"`
+}
+
+//Duplicate строки листа с одним ID товара
+type Duplicate struct {
+	OfferID int   `json:"offer_id"`
+	Rows    []int `json:"rows"`
+}
+
+//Lint проверяет файл по профилю так же, как импорт, и собирает все ошибки строк и повторяющиеся ID товаров
+func Lint(file *excelize.File, profile Profile) (*Report, error) {
+	report := &Report{Profile: profile.Name, Errors: []RowError{}, Duplicates: []Duplicate{}, Reasons: RowErrors{}}
+	rowsByID := make(map[int][]int)
+	err := profile.each(file, func(row int, o Offer, rowErr *RowError) {
+		report.Rows++
+		if rowErr != nil {
+			report.Errors = append(report.Errors, *rowErr)
+			report.Reasons.Add(rowErr.Reason)
+			return
+		}
+		report.Valid++
+		rowsByID[o.OfferID] = append(rowsByID[o.OfferID], row)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for offerID, rows := range rowsByID {
+		if len(rows) > 1 {
+			report.Duplicates = append(report.Duplicates, Duplicate{OfferID: offerID, Rows: rows})
+		}
+	}
+	sort.Slice(report.Duplicates, func(i, j int) bool { return report.Duplicates[i].OfferID < report.Duplicates[j].OfferID })
+	return report, nil
+}
@@ -0,0 +1,582 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/store"
+)
+
+type offerKey struct {
+	sellerID int
+	offerID  int
+}
+
+type apiKey struct {
+	key  store.APIKey
+	hash string
+}
+
+//Store хранилище в памяти процесса. Данные теряются при перезапуске,
+//подходит для тестов и запуска API без базы данных
+type Store struct {
+	mu sync.Mutex
+
+	sellers  map[int]store.Seller
+	offers   map[offerKey]parser.Offer
+	tasks    map[int64]store.Task
+	previews map[int64][]store.OfferDiff
+	keys     map[int64]apiKey
+	audit    []store.AuditEntry
+	history  []store.OfferEvent
+
+	lastTaskID  int64
+	lastKeyID   int64
+	lastAuditID int64
+	lastEventID int64
+}
+
+var _ store.Store = (*Store)(nil)
+
+//New создает пустое хранилище
+func New() *Store {
+	return &Store{
+		sellers:  make(map[int]store.Seller),
+		offers:   make(map[offerKey]parser.Offer),
+		tasks:    make(map[int64]store.Task),
+		previews: make(map[int64][]store.OfferDiff),
+		keys:     make(map[int64]apiKey),
+	}
+}
+
+//Ping всегда успешен
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+//Close ничего не делает, данные остаются доступны
+func (s *Store) Close() error {
+	return nil
+}
+
+//GetOffer возвращает товар продавца
+func (s *Store) GetOffer(ctx context.Context, sellerID int, offerID int) (*parser.Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offer, ok := s.offers[offerKey{sellerID, offerID}]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &offer, nil
+}
+
+//SearchOffers ищет товары по ID, продавцу и подстроке имени
+func (s *Store) SearchOffers(ctx context.Context, search store.OfferSearch) ([]parser.Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := s.offers
+	if !search.AsOf.IsZero() {
+		current = s.offersAsOf(search.AsOf)
+	}
+	var offers []parser.Offer
+	for key, offer := range current {
+		if search.OfferID != 0 && key.offerID != search.OfferID {
+			continue
+		}
+		if search.SellerID != 0 && key.sellerID != search.SellerID {
+			continue
+		}
+		if !strings.Contains(offer.Name, search.NameSearch) {
+			continue
+		}
+		offers = append(offers, offer)
+	}
+	sort.Slice(offers, func(i, j int) bool {
+		if offers[i].SellerID != offers[j].SellerID {
+			return offers[i].SellerID < offers[j].SellerID
+		}
+		return offers[i].OfferID < offers[j].OfferID
+	})
+	return offers, nil
+}
+
+//UpsertOffers добавляет новые товары продавца и обновляет изменившиеся
+func (s *Store) UpsertOffers(ctx context.Context, sellerID int, taskID int64, offers []parser.Offer) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sellers[sellerID]; !ok {
+		return 0, 0, store.ErrNotFound
+	}
+	inserts, updates := 0, 0
+	for _, offer := range offers {
+		offer.SellerID = sellerID
+		key := offerKey{sellerID, offer.OfferID}
+		current, ok := s.offers[key]
+		if !ok {
+			inserts++
+			s.record(key, taskID, nil, &offer)
+		} else if current != offer {
+			updates++
+			s.record(key, taskID, &current, &offer)
+		}
+		s.offers[key] = offer
+	}
+	return inserts, updates, nil
+}
+
+//ApplyOfferDiffs записывает изменения, если все текущие товары равны Old
+func (s *Store) ApplyOfferDiffs(ctx context.Context, sellerID int, taskID int64, diffs []store.OfferDiff) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sellers[sellerID]; !ok {
+		return store.ErrNotFound
+	}
+	for _, d := range diffs {
+		current, ok := s.offers[offerKey{sellerID, d.OfferID}]
+		if ok != (d.Old != nil) || ok && current != *d.Old {
+			return store.ErrChanged
+		}
+	}
+	for _, d := range diffs {
+		key := offerKey{sellerID, d.OfferID}
+		if d.New == nil {
+			s.record(key, taskID, d.Old, nil)
+			delete(s.offers, key)
+			continue
+		}
+		offer := *d.New
+		offer.OfferID, offer.SellerID = d.OfferID, sellerID
+		s.record(key, taskID, d.Old, &offer)
+		s.offers[key] = offer
+	}
+	return nil
+}
+
+//ChangeOffer атомарно читает товар, применяет change и записывает результат
+func (s *Store) ChangeOffer(ctx context.Context, sellerID int, offerID int, taskID int64, change store.OfferChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := offerKey{sellerID, offerID}
+	var current *parser.Offer
+	if offer, ok := s.offers[key]; ok {
+		current = &offer
+	}
+	next, err := change(current)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		if current != nil {
+			s.record(key, taskID, current, nil)
+		}
+		delete(s.offers, key)
+		return nil
+	}
+	if _, ok := s.sellers[sellerID]; !ok {
+		return store.ErrNotFound
+	}
+	offer := *next
+	offer.SellerID = sellerID
+	offer.OfferID = offerID
+	if current == nil || *current != offer {
+		s.record(key, taskID, current, &offer)
+	}
+	s.offers[key] = offer
+	return nil
+}
+
+//record добавляет изменение товара в историю
+func (s *Store) record(key offerKey, taskID int64, old, next *parser.Offer) {
+	s.lastEventID++
+	event := store.OfferEvent{ID: s.lastEventID, SellerID: key.sellerID, OfferID: key.offerID, TaskID: taskID, CreatedAt: time.Now()}
+	if old != nil {
+		o := *old
+		event.Old = &o
+	}
+	if next != nil {
+		n := *next
+		event.New = &n
+	}
+	s.history = append(s.history, event)
+}
+
+//OfferHistory возвращает историю товара от старых изменений к новым
+func (s *Store) OfferHistory(ctx context.Context, sellerID int, offerID int) ([]store.OfferEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := []store.OfferEvent{}
+	for _, e := range s.history {
+		if e.SellerID == sellerID && e.OfferID == offerID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+//TaskHistory возвращает изменения товаров задачи по порядку записи
+func (s *Store) TaskHistory(ctx context.Context, taskID int64) ([]store.OfferEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := []store.OfferEvent{}
+	for _, e := range s.history {
+		if e.TaskID == taskID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+//offersAsOf состояние товаров на момент asOf по истории
+func (s *Store) offersAsOf(asOf time.Time) map[offerKey]parser.Offer {
+	end := sort.Search(len(s.history), func(i int) bool { return s.history[i].CreatedAt.After(asOf) })
+	return replay(s.history[:end])
+}
+
+//replay состояние товаров после изменений events
+func replay(events []store.OfferEvent) map[offerKey]parser.Offer {
+	offers := make(map[offerKey]parser.Offer)
+	for _, e := range events {
+		key := offerKey{e.SellerID, e.OfferID}
+		if e.New == nil {
+			delete(offers, key)
+		} else {
+			offers[key] = *e.New
+		}
+	}
+	return offers
+}
+
+//TaskSnapshot возвращает товары продавца после последнего изменения задачи taskID
+//или ближайшей предыдущей задачи с изменениями по возрастанию ID
+func (s *Store) TaskSnapshot(ctx context.Context, sellerID int, taskID int64) ([]parser.Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var writer int64
+	for _, e := range s.history {
+		if e.SellerID == sellerID && e.TaskID <= taskID && e.TaskID > writer {
+			writer = e.TaskID
+		}
+	}
+	end := 0
+	for i, e := range s.history {
+		if writer != 0 && e.SellerID == sellerID && e.TaskID == writer {
+			end = i + 1
+		}
+	}
+	offers := []parser.Offer{}
+	for key, offer := range replay(s.history[:end]) {
+		if key.sellerID == sellerID {
+			offers = append(offers, offer)
+		}
+	}
+	sort.Slice(offers, func(i, j int) bool { return offers[i].OfferID < offers[j].OfferID })
+	return offers, nil
+}
+
+//CreateTask добавляет задачу в статусе TaskProcessing
+func (s *Store) CreateTask(ctx context.Context, url string, sellerID int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sellers[sellerID]; !ok {
+		return 0, store.ErrNotFound
+	}
+	s.lastTaskID++
+	s.tasks[s.lastTaskID] = store.Task{ID: s.lastTaskID, URL: url, SellerID: sellerID, Status: store.TaskProcessing}
+	return s.lastTaskID, nil
+}
+
+//GetTask возвращает задачу
+func (s *Store) GetTask(ctx context.Context, taskID int64) (*store.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, ok := s.tasks[taskID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &task, nil
+}
+
+//ListTasks возвращает задачи по возрастанию ID
+func (s *Store) ListTasks(ctx context.Context, filter store.TaskFilter) ([]store.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tasks := []store.Task{}
+	for _, task := range s.tasks {
+		if filter.SellerID != 0 && task.SellerID != filter.SellerID {
+			continue
+		}
+		if filter.Status != "" && task.Status != filter.Status {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+//UpdateTask записывает статус и счетчики задачи
+func (s *Store) UpdateTask(ctx context.Context, task store.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.tasks[task.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	task.URL = current.URL
+	task.SellerID = current.SellerID
+	s.tasks[task.ID] = task
+	return nil
+}
+
+//ClaimTask переводит задачу из TaskQueued в TaskProcessing
+func (s *Store) ClaimTask(ctx context.Context, taskID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, ok := s.tasks[taskID]
+	if !ok || task.Status != store.TaskQueued {
+		return false, nil
+	}
+	task.Status = store.TaskProcessing
+	s.tasks[taskID] = task
+	return true, nil
+}
+
+//SavePreview сохраняет изменения пробного импорта задачи
+func (s *Store) SavePreview(ctx context.Context, taskID int64, diffs []store.OfferDiff) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[taskID]; !ok {
+		return store.ErrNotFound
+	}
+	saved := append([]store.OfferDiff(nil), diffs...)
+	sort.Slice(saved, func(i, j int) bool { return saved[i].OfferID < saved[j].OfferID })
+	s.previews[taskID] = saved
+	return nil
+}
+
+//ListPreview возвращает сохраненные изменения задачи по возрастанию ID товара
+func (s *Store) ListPreview(ctx context.Context, taskID int64, offset int, limit int) ([]store.OfferDiff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	diffs := s.previews[taskID]
+	diffs = diffs[min(offset, len(diffs)):]
+	if limit > 0 {
+		diffs = diffs[:min(limit, len(diffs))]
+	}
+	return append([]store.OfferDiff{}, diffs...), nil
+}
+
+//CreateSeller добавляет продавца
+func (s *Store) CreateSeller(ctx context.Context, seller *store.Seller) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sellers[seller.ID]; ok {
+		return store.ErrConflict
+	}
+	if seller.Status == "" {
+		seller.Status = store.SellerActive
+	}
+	seller.CreatedAt = time.Now()
+	s.sellers[seller.ID] = *seller
+	return nil
+}
+
+//GetSeller возвращает продавца
+func (s *Store) GetSeller(ctx context.Context, sellerID int) (*store.Seller, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seller, ok := s.sellers[sellerID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &seller, nil
+}
+
+//ListSellers возвращает всех продавцов или одного, если sellerID не 0
+func (s *Store) ListSellers(ctx context.Context, sellerID int) ([]store.Seller, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sellers := []store.Seller{}
+	for id, seller := range s.sellers {
+		if sellerID == 0 || id == sellerID {
+			sellers = append(sellers, seller)
+		}
+	}
+	sort.Slice(sellers, func(i, j int) bool { return sellers[i].ID < sellers[j].ID })
+	return sellers, nil
+}
+
+//UpdateSeller записывает имя, email и статус продавца
+func (s *Store) UpdateSeller(ctx context.Context, seller store.Seller) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.sellers[seller.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	seller.CreatedAt = current.CreatedAt
+	s.sellers[seller.ID] = seller
+	return nil
+}
+
+//DeleteSeller удаляет продавца вместе с его товарами, задачами и ключами
+func (s *Store) DeleteSeller(ctx context.Context, sellerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sellers[sellerID]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.sellers, sellerID)
+	for key := range s.offers {
+		if key.sellerID == sellerID {
+			delete(s.offers, key)
+		}
+	}
+	history := s.history[:0]
+	for _, e := range s.history {
+		if e.SellerID != sellerID {
+			history = append(history, e)
+		}
+	}
+	s.history = history
+	for id, task := range s.tasks {
+		if task.SellerID == sellerID {
+			delete(s.tasks, id)
+			delete(s.previews, id)
+		}
+	}
+	for id, key := range s.keys {
+		if key.key.SellerID == sellerID {
+			delete(s.keys, id)
+		}
+	}
+	return nil
+}
+
+//CreateAPIKey сохраняет ключ с хэшем
+func (s *Store) CreateAPIKey(ctx context.Context, key *store.APIKey, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createAPIKey(key, hash)
+}
+
+func (s *Store) createAPIKey(key *store.APIKey, hash string) error {
+	for _, k := range s.keys {
+		if k.hash == hash {
+			return store.ErrConflict
+		}
+	}
+	s.lastKeyID++
+	key.ID = s.lastKeyID
+	key.CreatedAt = time.Now()
+	stored := *key
+	stored.Key = ""
+	s.keys[key.ID] = apiKey{stored, hash}
+	return nil
+}
+
+//GetAPIKey возвращает ключ
+func (s *Store) GetAPIKey(ctx context.Context, keyID int64) (*store.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[keyID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &k.key, nil
+}
+
+//FindAPIKey ищет действующий ключ по хэшу
+func (s *Store) FindAPIKey(ctx context.Context, hash string) (*store.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.keys {
+		if k.hash == hash && k.key.RevokedAt == nil {
+			return &k.key, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+//ListAPIKeys возвращает все ключи или ключи продавца, если sellerID не 0
+func (s *Store) ListAPIKeys(ctx context.Context, sellerID int) ([]store.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []store.APIKey{}
+	for _, k := range s.keys {
+		if sellerID == 0 || k.key.SellerID == sellerID {
+			keys = append(keys, k.key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+//RevokeAPIKey отзывает действующий ключ
+func (s *Store) RevokeAPIKey(ctx context.Context, keyID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revokeAPIKey(keyID)
+}
+
+func (s *Store) revokeAPIKey(keyID int64) error {
+	k, ok := s.keys[keyID]
+	if !ok || k.key.RevokedAt != nil {
+		return store.ErrNotFound
+	}
+	now := time.Now()
+	k.key.RevokedAt = &now
+	s.keys[keyID] = k
+	return nil
+}
+
+//RotateAPIKey отзывает действующий ключ и сохраняет next
+func (s *Store) RotateAPIKey(ctx context.Context, keyID int64, next *store.APIKey, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.revokeAPIKey(keyID); err != nil {
+		return err
+	}
+	return s.createAPIKey(next, hash)
+}
+
+//AppendAudit добавляет запись в журнал аудита
+func (s *Store) AppendAudit(ctx context.Context, entry *store.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastAuditID++
+	entry.ID = s.lastAuditID
+	entry.CreatedAt = time.Now()
+	s.audit = append(s.audit, *entry)
+	return nil
+}
+
+//ListAudit возвращает записи журнала аудита от новых к старым
+func (s *Store) ListAudit(ctx context.Context, filter store.AuditFilter) ([]store.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := []store.AuditEntry{}
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		e := s.audit[i]
+		switch {
+		case filter.SellerID != 0 && e.SellerID != filter.SellerID,
+			filter.KeyID != 0 && e.KeyID != filter.KeyID,
+			filter.Role != "" && e.Role != filter.Role,
+			filter.Method != "" && e.Method != filter.Method,
+			filter.Outcome != "" && e.Outcome != filter.Outcome,
+			!strings.HasPrefix(e.Path, filter.PathPrefix),
+			!filter.From.IsZero() && e.CreatedAt.Before(filter.From),
+			!filter.To.IsZero() && !e.CreatedAt.Before(filter.To):
+			continue
+		}
+		entries = append(entries, e)
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,6 @@
+DROP TABLE audit_log;
+DROP FUNCTION audit_log_append_only();
+DROP TABLE api_key;
+DROP TABLE task_log;
+DROP TABLE offer;
+DROP TABLE seller;
@@ -0,0 +1,63 @@
+-- Базовая схема. IF NOT EXISTS позволяет принять под управление миграций базу,
+-- созданную раньше из docker_postgres_init.sql
+CREATE TABLE IF NOT EXISTS seller (
+	id integer,
+	name text NOT NULL DEFAULT '',
+	email text NOT NULL DEFAULT '',
+	status text NOT NULL DEFAULT 'active',
+	created_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS offer (
+	id integer,
+	name text NOT NULL,
+	price real NOT NULL,
+	quantity integer NOT NULL,
+	available boolean,
+	seller_id integer REFERENCES seller ON DELETE CASCADE,
+	CONSTRAINT offer_seller_id UNIQUE (id, seller_id)
+);
+CREATE TABLE IF NOT EXISTS task_log (
+	id BIGSERIAL,
+	url char(2000),
+	seller_id integer REFERENCES seller ON DELETE CASCADE,
+	status text,
+	elapsed_time text,
+	lines_parsed integer,
+	new_offers integer,
+	updated_offers integer,
+	deleted_offers integer DEFAULT 0,
+	errors integer,
+	PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS api_key (
+	id BIGSERIAL,
+	seller_id integer REFERENCES seller ON DELETE CASCADE,
+	role text NOT NULL,
+	prefix text NOT NULL,
+	key_hash text NOT NULL UNIQUE,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	revoked_at timestamptz,
+	PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	key_id bigint,
+	role text NOT NULL,
+	method text NOT NULL,
+	path text NOT NULL,
+	seller_id integer,
+	status integer NOT NULL,
+	outcome text NOT NULL,
+	remote_addr text NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
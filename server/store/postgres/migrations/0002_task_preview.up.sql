@@ -0,0 +1,9 @@
+-- Изменения пробного импорта (dry_run) для просмотра и последующего применения.
+-- Товары хранятся в JSON, old_offer пустой для нового товара, new_offer для удаляемого
+CREATE TABLE task_preview (
+	task_id bigint REFERENCES task_log ON DELETE CASCADE,
+	offer_id integer,
+	old_offer text,
+	new_offer text,
+	PRIMARY KEY (task_id, offer_id)
+);
@@ -0,0 +1,23 @@
+-- История изменений товаров: старое (old_*) и новое состояние товара, задача импорта и время изменения.
+-- Старого состояния нет у добавленного товара, нового у удаленного. Текущие товары записываются
+-- как добавленные в момент миграции, чтобы поиск на момент времени находил их
+CREATE TABLE offer_history (
+	id BIGSERIAL,
+	seller_id integer REFERENCES seller ON DELETE CASCADE,
+	offer_id integer NOT NULL,
+	task_id bigint REFERENCES task_log ON DELETE SET NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	old_name text,
+	old_price real,
+	old_quantity integer,
+	old_available boolean,
+	name text,
+	price real,
+	quantity integer,
+	available boolean,
+	PRIMARY KEY (id)
+);
+CREATE INDEX offer_history_offer ON offer_history (seller_id, offer_id, id);
+CREATE INDEX offer_history_created_at ON offer_history (created_at);
+INSERT INTO offer_history (seller_id, offer_id, name, price, quantity, available)
+	SELECT seller_id, id, name, price, quantity, available FROM offer ORDER BY seller_id, id;
@@ -0,0 +1,2 @@
+-- Колонки входят в схему 0001_init и удаляются вместе с ней
+SELECT 1;
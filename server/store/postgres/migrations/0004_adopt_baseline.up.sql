@@ -0,0 +1,8 @@
+-- Базы, созданные раньше из docker_postgres_init.sql, уже содержат seller и task_log, поэтому
+-- CREATE TABLE IF NOT EXISTS в 0001_init их не меняет. Добавляем колонки, которых в той схеме нет.
+-- В базе, созданной миграциями, колонки уже есть и ничего не меняется
+ALTER TABLE seller ADD COLUMN IF NOT EXISTS name text NOT NULL DEFAULT '';
+ALTER TABLE seller ADD COLUMN IF NOT EXISTS email text NOT NULL DEFAULT '';
+ALTER TABLE seller ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'active';
+ALTER TABLE seller ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE task_log ADD COLUMN IF NOT EXISTS deleted_offers integer DEFAULT 0;
@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/goserg/Golang-merchant-API/migrate"
+	"github.com/goserg/Golang-merchant-API/store/sqlstore"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+//Dialect особенности SQL PostgreSQL
+var Dialect = sqlstore.Dialect{
+	ForUpdate: "FOR UPDATE",
+	Contains:  "strpos(%s, %s) > 0",
+	HasPrefix: "starts_with(%s, %s)",
+}
+
+//New создает хранилище в PostgreSQL поверх открытого пула соединений
+func New(db *sql.DB) *sqlstore.Store {
+	return sqlstore.New(db, Dialect)
+}
+
+//Migrator возвращает миграции схемы PostgreSQL для базы db
+func Migrator(db *sql.DB) (*migrate.Migrator, error) {
+	dir, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, dir, `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`)
+}
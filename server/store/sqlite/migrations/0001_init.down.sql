@@ -0,0 +1,5 @@
+DROP TABLE audit_log;
+DROP TABLE api_key;
+DROP TABLE task_log;
+DROP TABLE offer;
+DROP TABLE seller;
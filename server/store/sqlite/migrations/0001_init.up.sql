@@ -0,0 +1,58 @@
+CREATE TABLE seller (
+	id integer,
+	name text NOT NULL DEFAULT '',
+	email text NOT NULL DEFAULT '',
+	status text NOT NULL DEFAULT 'active',
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+CREATE TABLE offer (
+	id integer,
+	name text NOT NULL,
+	price real NOT NULL,
+	quantity integer NOT NULL,
+	available boolean,
+	seller_id integer REFERENCES seller ON DELETE CASCADE,
+	CONSTRAINT offer_seller_id UNIQUE (id, seller_id)
+);
+CREATE TABLE task_log (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	url text,
+	seller_id integer REFERENCES seller ON DELETE CASCADE,
+	status text,
+	elapsed_time text,
+	lines_parsed integer,
+	new_offers integer,
+	updated_offers integer,
+	deleted_offers integer DEFAULT 0,
+	errors integer
+);
+CREATE TABLE api_key (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	seller_id integer REFERENCES seller ON DELETE CASCADE,
+	role text NOT NULL,
+	prefix text NOT NULL,
+	key_hash text NOT NULL UNIQUE,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at timestamp
+);
+CREATE TABLE audit_log (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	key_id bigint,
+	role text NOT NULL,
+	method text NOT NULL,
+	path text NOT NULL,
+	seller_id integer,
+	status integer NOT NULL,
+	outcome text NOT NULL,
+	remote_addr text NOT NULL
+);
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
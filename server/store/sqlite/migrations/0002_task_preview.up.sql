@@ -0,0 +1,7 @@
+CREATE TABLE task_preview (
+	task_id integer REFERENCES task_log ON DELETE CASCADE,
+	offer_id integer,
+	old_offer text,
+	new_offer text,
+	PRIMARY KEY (task_id, offer_id)
+);
@@ -0,0 +1 @@
+DROP TABLE offer_history;
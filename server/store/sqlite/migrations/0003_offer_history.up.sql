@@ -0,0 +1,19 @@
+CREATE TABLE offer_history (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	seller_id integer REFERENCES seller ON DELETE CASCADE,
+	offer_id integer NOT NULL,
+	task_id integer REFERENCES task_log ON DELETE SET NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	old_name text,
+	old_price real,
+	old_quantity integer,
+	old_available boolean,
+	name text,
+	price real,
+	quantity integer,
+	available boolean
+);
+CREATE INDEX offer_history_offer ON offer_history (seller_id, offer_id, id);
+CREATE INDEX offer_history_created_at ON offer_history (created_at);
+INSERT INTO offer_history (seller_id, offer_id, name, price, quantity, available)
+	SELECT seller_id, id, name, price, quantity, available FROM offer ORDER BY seller_id, id;
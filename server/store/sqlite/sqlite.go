@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+	"net/url"
+
+	"github.com/goserg/Golang-merchant-API/migrate"
+	"github.com/goserg/Golang-merchant-API/store/sqlstore"
+
+	_ "modernc.org/sqlite"
+)
+
+//migrations та же схема, что и у PostgreSQL, в синтаксисе SQLite
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+//Dialect особенности SQL SQLite. Блокировка строк не нужна:
+//транзакции начинаются с BEGIN IMMEDIATE и сразу захватывают запись в базу
+var Dialect = sqlstore.Dialect{
+	Contains:  "instr(%s, %s) > 0",
+	HasPrefix: "instr(%s, %s) = 1",
+}
+
+//Open открывает файл базы path, создает его, если его нет. Таблицы создаются миграциями, см. Migrator
+func Open(path string) (*sqlstore.Store, error) {
+	query := url.Values{}
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Set("_txlock", "immediate")
+	query.Set("_time_format", "sqlite")
+	db, err := sql.Open("sqlite", "file:"+path+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	return sqlstore.New(db, Dialect), nil
+}
+
+//Migrator возвращает миграции схемы SQLite для базы db
+func Migrator(db *sql.DB) (*migrate.Migrator, error) {
+	dir, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, dir, "")
+}
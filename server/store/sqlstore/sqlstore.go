@@ -0,0 +1,772 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/parser"
+	"github.com/goserg/Golang-merchant-API/store"
+	"github.com/goserg/Golang-merchant-API/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+//Dialect различия SQL между базами данных
+type Dialect struct {
+	//ForUpdate блокировка строки, которую читают перед изменением
+	ForUpdate string
+	//Contains шаблон условия "строка содержит подстроку" для fmt.Sprintf: колонка и параметр
+	Contains string
+	//HasPrefix шаблон условия "строка начинается с префикса" для fmt.Sprintf: колонка и параметр
+	HasPrefix string
+}
+
+//Store хранилище в SQL базе данных со схемой из миграций пакетов postgres и sqlite
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var _ store.Store = (*Store)(nil)
+
+//New создает хранилище поверх открытого пула соединений
+func New(db *sql.DB, dialect Dialect) *Store {
+	return &Store{db, dialect}
+}
+
+//DB возвращает пул соединений хранилища
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+//Ping проверяет соединение с базой
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+//Close закрывает пул соединений
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+//GetOffer возвращает товар продавца
+func (s *Store) GetOffer(ctx context.Context, sellerID int, offerID int) (*parser.Offer, error) {
+	return getOffer(ctx, s.db, sellerID, offerID, "")
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func getOffer(ctx context.Context, db queryer, sellerID int, offerID int, lock string) (*parser.Offer, error) {
+	var offer parser.Offer
+	err := db.QueryRowContext(ctx,
+		`SELECT id, name, price, quantity, available, seller_id FROM "offer" WHERE id=$1 AND seller_id=$2 `+lock,
+		offerID, sellerID,
+	).Scan(&offer.OfferID, &offer.Name, &offer.Price, &offer.Quantity, &offer.Available, &offer.SellerID)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+//SearchOffers ищет товары по ID, продавцу и подстроке имени, с AsOf в истории изменений
+func (s *Store) SearchOffers(ctx context.Context, search store.OfferSearch) ([]parser.Offer, error) {
+	from, idColumn := `"offer"`, "id"
+	query := []string{fmt.Sprintf(s.dialect.Contains, "name", "$1")}
+	args := []interface{}{search.NameSearch}
+	if !search.AsOf.IsZero() {
+		//последнее изменение каждого товара не позже AsOf, у удаленного товара name пустой
+		from, idColumn = `"offer_history"`, "offer_id"
+		args = append(args, search.AsOf.UTC())
+		query = append(query, fmt.Sprintf(`id IN (SELECT max(id) FROM "offer_history" WHERE created_at<=$%d
+			GROUP BY seller_id, offer_id)`, len(args)), "name IS NOT NULL")
+	}
+	if search.OfferID != 0 {
+		args = append(args, search.OfferID)
+		query = append(query, fmt.Sprintf("%s=$%d", idColumn, len(args)))
+	}
+	if search.SellerID != 0 {
+		args = append(args, search.SellerID)
+		query = append(query, fmt.Sprintf("seller_id=$%d", len(args)))
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+idColumn+`, name, price, quantity, available, seller_id FROM `+from+` WHERE `+strings.Join(query, " AND ")+
+			` ORDER BY seller_id, `+idColumn, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanOffers(rows)
+}
+
+//scanOffers читает товары из колонок id, name, price, quantity, available, seller_id и закрывает rows
+func scanOffers(rows *sql.Rows) ([]parser.Offer, error) {
+	defer rows.Close()
+	var offers []parser.Offer
+	for rows.Next() {
+		var offer parser.Offer
+		err := rows.Scan(&offer.OfferID, &offer.Name, &offer.Price, &offer.Quantity, &offer.Available, &offer.SellerID)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, offer)
+	}
+	return offers, rows.Err()
+}
+
+//UpsertOffers добавляет новые товары продавца и обновляет изменившиеся одной транзакцией
+func (s *Store) UpsertOffers(ctx context.Context, sellerID int, taskID int64, offers []parser.Offer) (int, int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	inserts, updates := 0, 0
+	for first := 0; first < len(offers); first += upsertBatchSize {
+		batch := offers[first:min(first+upsertBatchSize, len(offers))]
+		batchInserts, batchUpdates, err := upsertBatch(ctx, tx, sellerID, taskID, batch, s.dialect.ForUpdate)
+		if err != nil {
+			return 0, 0, err
+		}
+		inserts += batchInserts
+		updates += batchUpdates
+	}
+	_, span := tracing.Start(ctx, "commit")
+	err = tx.Commit()
+	tracing.End(span, err)
+	return inserts, updates, err
+}
+
+//upsertBatchSize сколько товаров записывается в одном спане трассировки
+const upsertBatchSize = 500
+
+//upsertBatch записывает часть товаров импорта в транзакции tx
+func upsertBatch(ctx context.Context, tx *sql.Tx, sellerID int, taskID int64, offers []parser.Offer, lock string) (inserts int, updates int, err error) {
+	ctx, span := tracing.Start(ctx, "upsert batch", attribute.Int("offers", len(offers)))
+	defer func() {
+		span.SetAttributes(attribute.Int("offers.inserted", inserts), attribute.Int("offers.updated", updates))
+		tracing.End(span, err)
+	}()
+	for _, offer := range offers {
+		offer.SellerID = sellerID
+		current, err := getOffer(ctx, tx, sellerID, offer.OfferID, lock)
+		switch {
+		case err == store.ErrNotFound:
+			err = writeOffer(ctx, tx, taskID, nil, &offer)
+			inserts++
+		case err != nil:
+		case *current != offer:
+			err = writeOffer(ctx, tx, taskID, current, &offer)
+			updates++
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return inserts, updates, nil
+}
+
+//ChangeOffer атомарно читает товар, применяет change и записывает результат
+func (s *Store) ChangeOffer(ctx context.Context, sellerID int, offerID int, taskID int64, change store.OfferChange) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := getOffer(ctx, tx, sellerID, offerID, s.dialect.ForUpdate)
+	if err == store.ErrNotFound {
+		current, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	next, err := change(current)
+	if err != nil {
+		return err
+	}
+	if next != nil {
+		offer := *next
+		offer.OfferID, offer.SellerID = offerID, sellerID
+		next = &offer
+	}
+	if next == nil && current == nil || next != nil && current != nil && *next == *current {
+		return nil
+	}
+	if err := writeOffer(ctx, tx, taskID, current, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//ApplyOfferDiffs записывает изменения одной транзакцией, если все текущие товары равны Old
+func (s *Store) ApplyOfferDiffs(ctx context.Context, sellerID int, taskID int64, diffs []store.OfferDiff) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, d := range diffs {
+		current, err := getOffer(ctx, tx, sellerID, d.OfferID, s.dialect.ForUpdate)
+		if err == store.ErrNotFound {
+			current, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+		if (current == nil) != (d.Old == nil) || current != nil && *current != *d.Old {
+			return store.ErrChanged
+		}
+		var next *parser.Offer
+		if d.New != nil {
+			offer := *d.New
+			offer.OfferID, offer.SellerID = d.OfferID, sellerID
+			next = &offer
+		}
+		if err := writeOffer(ctx, tx, taskID, current, next); err != nil {
+			return err
+		}
+	}
+	_, span := tracing.Start(ctx, "commit")
+	err = tx.Commit()
+	tracing.End(span, err)
+	return err
+}
+
+//writeOffer заменяет товар current на next и записывает изменение в историю с задачей taskID.
+//current равен nil для нового товара, next равен nil для удаления
+func writeOffer(ctx context.Context, tx *sql.Tx, taskID int64, current, next *parser.Offer) error {
+	var err error
+	switch {
+	case next == nil:
+		_, err = tx.ExecContext(ctx, `DELETE FROM "offer" WHERE id=$1 AND seller_id=$2`, current.OfferID, current.SellerID)
+	case current == nil:
+		err = insertOffer(ctx, tx, *next)
+	default:
+		err = updateOffer(ctx, tx, *next)
+	}
+	if err != nil {
+		return err
+	}
+	event := current
+	if event == nil {
+		event = next
+	}
+	args := []interface{}{event.SellerID, event.OfferID, taskID, now()}
+	args = append(args, historyValues(current)...)
+	args = append(args, historyValues(next)...)
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO "offer_history" (seller_id, offer_id, task_id, created_at, old_name, old_price, old_quantity, old_available,
+		name, price, quantity, available) VALUES($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8, $9, $10, $11, $12)`, args...,
+	)
+	return err
+}
+
+//historyValues колонки состояния товара в offer_history, NULL для отсутствующего товара
+func historyValues(offer *parser.Offer) []interface{} {
+	if offer == nil {
+		return []interface{}{nil, nil, nil, nil}
+	}
+	return []interface{}{offer.Name, offer.Price, offer.Quantity, offer.Available}
+}
+
+//historyOffer читает состояние товара из колонок offer_history
+type historyOffer struct {
+	name      sql.NullString
+	price     sql.NullFloat64
+	quantity  sql.NullInt64
+	available sql.NullBool
+}
+
+func (h *historyOffer) dest() []interface{} {
+	return []interface{}{&h.name, &h.price, &h.quantity, &h.available}
+}
+
+//offer товар продавца sellerID или nil, если в этом состоянии товара нет
+func (h *historyOffer) offer(sellerID int, offerID int) *parser.Offer {
+	if !h.name.Valid {
+		return nil
+	}
+	return &parser.Offer{OfferID: offerID, Name: h.name.String, Price: h.price.Float64, Quantity: h.quantity.Int64,
+		Available: h.available.Bool, SellerID: sellerID}
+}
+
+//OfferHistory возвращает историю товара от старых изменений к новым
+func (s *Store) OfferHistory(ctx context.Context, sellerID int, offerID int) ([]store.OfferEvent, error) {
+	return s.history(ctx, "seller_id=$1 AND offer_id=$2", sellerID, offerID)
+}
+
+//TaskHistory возвращает изменения товаров задачи по порядку записи
+func (s *Store) TaskHistory(ctx context.Context, taskID int64) ([]store.OfferEvent, error) {
+	return s.history(ctx, "task_id=$1", taskID)
+}
+
+//history читает записи offer_history по условию where по возрастанию ID
+func (s *Store) history(ctx context.Context, where string, args ...interface{}) ([]store.OfferEvent, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, seller_id, offer_id, COALESCE(task_id, 0), created_at, old_name, old_price, old_quantity, old_available,
+		name, price, quantity, available FROM "offer_history" WHERE `+where+` ORDER BY id`, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []store.OfferEvent{}
+	for rows.Next() {
+		var e store.OfferEvent
+		var old, next historyOffer
+		dest := append([]interface{}{&e.ID, &e.SellerID, &e.OfferID, &e.TaskID, &e.CreatedAt}, old.dest()...)
+		if err := rows.Scan(append(dest, next.dest()...)...); err != nil {
+			return nil, err
+		}
+		e.Old, e.New = old.offer(e.SellerID, e.OfferID), next.offer(e.SellerID, e.OfferID)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+//TaskSnapshot возвращает товары продавца после последнего изменения задачи taskID
+//или ближайшей предыдущей задачи с изменениями по возрастанию ID
+func (s *Store) TaskSnapshot(ctx context.Context, sellerID int, taskID int64) ([]parser.Offer, error) {
+	var writer sql.NullInt64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT max(task_id) FROM "offer_history" WHERE seller_id=$1 AND task_id<=$2`, sellerID, taskID,
+	).Scan(&writer)
+	if err != nil {
+		return nil, err
+	}
+	if !writer.Valid {
+		return []parser.Offer{}, nil
+	}
+	var lastID int64
+	err = s.db.QueryRowContext(ctx,
+		`SELECT max(id) FROM "offer_history" WHERE seller_id=$1 AND task_id=$2`, sellerID, writer.Int64,
+	).Scan(&lastID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT offer_id, name, price, quantity, available, seller_id FROM "offer_history"
+		WHERE id IN (SELECT max(id) FROM "offer_history" WHERE seller_id=$1 AND id<=$2 GROUP BY offer_id)
+		AND name IS NOT NULL ORDER BY offer_id`, sellerID, lastID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanOffers(rows)
+}
+
+func insertOffer(ctx context.Context, tx *sql.Tx, offer parser.Offer) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO "offer" (id, name, price, quantity, available, seller_id) VALUES($1, $2, $3, $4, $5, $6)`,
+		offer.OfferID, offer.Name, offer.Price, offer.Quantity, offer.Available, offer.SellerID,
+	)
+	return err
+}
+
+func updateOffer(ctx context.Context, tx *sql.Tx, offer parser.Offer) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE "offer" SET name=$1, price=$2, quantity=$3, available=$4 WHERE id=$5 AND seller_id=$6`,
+		offer.Name, offer.Price, offer.Quantity, offer.Available, offer.OfferID, offer.SellerID,
+	)
+	return err
+}
+
+//CreateTask добавляет задачу в статусе TaskProcessing
+func (s *Store) CreateTask(ctx context.Context, url string, sellerID int) (int64, error) {
+	var taskID int64
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO "task_log" ("status", "url", "seller_id") VALUES($1, $2, $3) RETURNING id`,
+		store.TaskProcessing, url, sellerID,
+	).Scan(&taskID)
+	return taskID, err
+}
+
+const taskColumns = `id, trim(url), seller_id, status, COALESCE(elapsed_time, ''), COALESCE(lines_parsed, 0),
+	COALESCE(new_offers, 0), COALESCE(updated_offers, 0), COALESCE(deleted_offers, 0), COALESCE(errors, 0)`
+
+func scanTask(row interface{ Scan(...interface{}) error }) (*store.Task, error) {
+	var t store.Task
+	err := row.Scan(&t.ID, &t.URL, &t.SellerID, &t.Status, &t.ElapsedTime, &t.LinesParsed,
+		&t.NewOffers, &t.UpdatedOffers, &t.DeletedOffers, &t.Errors)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+//GetTask возвращает задачу
+func (s *Store) GetTask(ctx context.Context, taskID int64) (*store.Task, error) {
+	t, err := scanTask(s.db.QueryRowContext(ctx, `SELECT `+taskColumns+` FROM "task_log" WHERE id=$1`, taskID))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	return t, err
+}
+
+//ListTasks возвращает задачи по возрастанию ID
+func (s *Store) ListTasks(ctx context.Context, filter store.TaskFilter) ([]store.Task, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+taskColumns+` FROM "task_log" WHERE ($1 = 0 OR seller_id=$1) AND ($2 = '' OR status=$2) ORDER BY id`,
+		filter.SellerID, filter.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tasks := []store.Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, *t)
+	}
+	return tasks, rows.Err()
+}
+
+//UpdateTask записывает статус и счетчики задачи
+func (s *Store) UpdateTask(ctx context.Context, t store.Task) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE "task_log" SET status=$1, elapsed_time=$2, lines_parsed=$3, new_offers=$4, updated_offers=$5,
+		deleted_offers=$6, errors=$7 WHERE id=$8`,
+		t.Status, t.ElapsedTime, t.LinesParsed, t.NewOffers, t.UpdatedOffers, t.DeletedOffers, t.Errors, t.ID,
+	)
+	return err
+}
+
+//ClaimTask переводит задачу из TaskQueued в TaskProcessing одним UPDATE
+func (s *Store) ClaimTask(ctx context.Context, taskID int64) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE "task_log" SET status=$1 WHERE id=$2 AND status=$3`, store.TaskProcessing, taskID, store.TaskQueued,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+//SavePreview сохраняет изменения пробного импорта задачи, товары хранятся в JSON
+func (s *Store) SavePreview(ctx context.Context, taskID int64, diffs []store.OfferDiff) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "task_preview" WHERE task_id=$1`, taskID); err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		old, err := offerJSON(d.Old)
+		if err != nil {
+			return err
+		}
+		next, err := offerJSON(d.New)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO "task_preview" (task_id, offer_id, old_offer, new_offer) VALUES($1, $2, $3, $4)`,
+			taskID, d.OfferID, old, next,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//ListPreview возвращает сохраненные изменения задачи по возрастанию ID товара
+func (s *Store) ListPreview(ctx context.Context, taskID int64, offset int, limit int) ([]store.OfferDiff, error) {
+	if limit <= 0 {
+		//SQLite не понимает OFFSET без LIMIT
+		limit = math.MaxInt32
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT offer_id, old_offer, new_offer FROM "task_preview" WHERE task_id=$1 ORDER BY offer_id LIMIT $2 OFFSET $3`,
+		taskID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	diffs := []store.OfferDiff{}
+	for rows.Next() {
+		var d store.OfferDiff
+		var old, next sql.NullString
+		if err := rows.Scan(&d.OfferID, &old, &next); err != nil {
+			return nil, err
+		}
+		if d.Old, err = parseOfferJSON(old); err != nil {
+			return nil, err
+		}
+		if d.New, err = parseOfferJSON(next); err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, rows.Err()
+}
+
+//offerJSON товар изменения для колонки old_offer или new_offer, nil для отсутствующего товара
+func offerJSON(offer *parser.Offer) (interface{}, error) {
+	if offer == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(offer)
+	return string(data), err
+}
+
+func parseOfferJSON(value sql.NullString) (*parser.Offer, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	var offer parser.Offer
+	if err := json.Unmarshal([]byte(value.String), &offer); err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+//CreateSeller добавляет продавца
+func (s *Store) CreateSeller(ctx context.Context, seller *store.Seller) error {
+	if seller.Status == "" {
+		seller.Status = store.SellerActive
+	}
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO "seller" (id, name, email, status, created_at) VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING RETURNING created_at`, seller.ID, seller.Name, seller.Email, seller.Status, now(),
+	).Scan(&seller.CreatedAt)
+	if err == sql.ErrNoRows {
+		return store.ErrConflict
+	}
+	return err
+}
+
+//GetSeller возвращает продавца
+func (s *Store) GetSeller(ctx context.Context, sellerID int) (*store.Seller, error) {
+	var seller store.Seller
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, name, email, status, created_at FROM "seller" WHERE id=$1`, sellerID,
+	).Scan(&seller.ID, &seller.Name, &seller.Email, &seller.Status, &seller.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &seller, nil
+}
+
+//ListSellers возвращает всех продавцов или одного, если sellerID не 0
+func (s *Store) ListSellers(ctx context.Context, sellerID int) ([]store.Seller, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, email, status, created_at FROM "seller" WHERE $1 = 0 OR id = $1 ORDER BY id`, sellerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sellers := []store.Seller{}
+	for rows.Next() {
+		var seller store.Seller
+		if err := rows.Scan(&seller.ID, &seller.Name, &seller.Email, &seller.Status, &seller.CreatedAt); err != nil {
+			return nil, err
+		}
+		sellers = append(sellers, seller)
+	}
+	return sellers, rows.Err()
+}
+
+//UpdateSeller записывает имя, email и статус продавца
+func (s *Store) UpdateSeller(ctx context.Context, seller store.Seller) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE "seller" SET name=$1, email=$2, status=$3 WHERE id=$4`, seller.Name, seller.Email, seller.Status, seller.ID,
+	)
+	return checkAffected(res, err)
+}
+
+//DeleteSeller удаляет продавца, товары, задачи и ключи удаляются каскадно
+func (s *Store) DeleteSeller(ctx context.Context, sellerID int) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM "seller" WHERE id=$1`, sellerID)
+	return checkAffected(res, err)
+}
+
+func checkAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+//CreateAPIKey сохраняет ключ с хэшем
+func (s *Store) CreateAPIKey(ctx context.Context, key *store.APIKey, hash string) error {
+	return createAPIKey(ctx, s.db, key, hash)
+}
+
+func createAPIKey(ctx context.Context, db queryer, key *store.APIKey, hash string) error {
+	return db.QueryRowContext(ctx,
+		`INSERT INTO "api_key" (seller_id, role, prefix, key_hash, created_at) VALUES(NULLIF($1, 0), $2, $3, $4, $5)
+		RETURNING id, created_at`, key.SellerID, key.Role, key.Prefix, hash, now(),
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+const apiKeyColumns = `id, COALESCE(seller_id, 0), role, prefix, created_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*store.APIKey, error) {
+	var key store.APIKey
+	err := row.Scan(&key.ID, &key.SellerID, &key.Role, &key.Prefix, &key.CreatedAt, &key.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+//GetAPIKey возвращает ключ
+func (s *Store) GetAPIKey(ctx context.Context, keyID int64) (*store.APIKey, error) {
+	return scanAPIKey(s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM "api_key" WHERE id=$1`, keyID))
+}
+
+//FindAPIKey ищет действующий ключ по хэшу
+func (s *Store) FindAPIKey(ctx context.Context, hash string) (*store.APIKey, error) {
+	return scanAPIKey(s.db.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM "api_key" WHERE key_hash=$1 AND revoked_at IS NULL`, hash,
+	))
+}
+
+//ListAPIKeys возвращает все ключи или ключи продавца, если sellerID не 0
+func (s *Store) ListAPIKeys(ctx context.Context, sellerID int) ([]store.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM "api_key" WHERE $1 = 0 OR seller_id = $1 ORDER BY id`, sellerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []store.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+//RevokeAPIKey отзывает действующий ключ
+func (s *Store) RevokeAPIKey(ctx context.Context, keyID int64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE "api_key" SET revoked_at=$1 WHERE id=$2 AND revoked_at IS NULL`, now(), keyID)
+	return checkAffected(res, err)
+}
+
+//RotateAPIKey отзывает действующий ключ и сохраняет next одной транзакцией
+func (s *Store) RotateAPIKey(ctx context.Context, keyID int64, next *store.APIKey, hash string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE "api_key" SET revoked_at=$1 WHERE id=$2 AND revoked_at IS NULL`, now(), keyID)
+	if err := checkAffected(res, err); err != nil {
+		return err
+	}
+	if err := createAPIKey(ctx, tx, next, hash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//AppendAudit добавляет запись в журнал аудита
+func (s *Store) AppendAudit(ctx context.Context, e *store.AuditEntry) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO "audit_log" (key_id, role, method, path, seller_id, status, outcome, remote_addr, created_at)
+		VALUES(NULLIF($1, 0), $2, $3, $4, NULLIF($5, 0), $6, $7, $8, $9) RETURNING id, created_at`,
+		e.KeyID, e.Role, e.Method, e.Path, e.SellerID, e.Status, e.Outcome, e.RemoteAddr, now(),
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+//ListAudit возвращает записи журнала аудита от новых к старым
+func (s *Store) ListAudit(ctx context.Context, f store.AuditFilter) ([]store.AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if f.SellerID != 0 {
+		add("seller_id=$%d", f.SellerID)
+	}
+	if f.KeyID != 0 {
+		add("key_id=$%d", f.KeyID)
+	}
+	if f.Role != "" {
+		add("role=$%d", f.Role)
+	}
+	if f.Method != "" {
+		add("method=$%d", f.Method)
+	}
+	if f.Outcome != "" {
+		add("outcome=$%d", f.Outcome)
+	}
+	if f.PathPrefix != "" {
+		args = append(args, f.PathPrefix)
+		conditions = append(conditions, fmt.Sprintf(s.dialect.HasPrefix, "path", fmt.Sprintf("$%d", len(args))))
+	}
+	if !f.From.IsZero() {
+		add("created_at>=$%d", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		add("created_at<$%d", f.To.UTC())
+	}
+	query := `SELECT id, created_at, COALESCE(key_id, 0), role, method, path, COALESCE(seller_id, 0), status, outcome, remote_addr
+		FROM "audit_log"`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []store.AuditEntry{}
+	for rows.Next() {
+		var e store.AuditEntry
+		err := rows.Scan(&e.ID, &e.CreatedAt, &e.KeyID, &e.Role, &e.Method, &e.Path, &e.SellerID, &e.Status, &e.Outcome, &e.RemoteAddr)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+//now время записи. Передается параметром, а не функцией базы, и всегда в UTC,
+//чтобы значения одинаково сравнивались во всех базах
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,268 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/goserg/Golang-merchant-API/parser"
+)
+
+var (
+	//ErrNotFound запись не найдена
+	ErrNotFound = errors.New("not found")
+	//ErrConflict запись с таким ключом уже существует
+	ErrConflict = errors.New("already exists")
+	//ErrChanged товары изменились после того, как их прочитали, и изменение не записано
+	ErrChanged = errors.New("offers changed")
+)
+
+const (
+	//SellerActive продавец может загружать товары
+	SellerActive = "active"
+	//SellerSuspended загрузка товаров продавца запрещена
+	SellerSuspended = "suspended"
+
+	//TaskProcessing статус задачи до окончания импорта
+	TaskProcessing = "Processing..."
+	//TaskQueued импорт прерван остановкой сервера и будет повторен при следующем запуске
+	TaskQueued = "Queued"
+	//TaskCanceled импорт отменен по запросу, записанные до отмены товары остаются
+	TaskCanceled = "Canceled"
+	//TaskPreview пробный импорт закончен, изменения сохранены для просмотра и еще не записаны
+	TaskPreview = "Preview"
+	//TaskApplied изменения пробного импорта записаны
+	TaskApplied = "Applied"
+	//TaskReverted изменения задачи отменены отдельной задачей
+	TaskReverted = "Reverted"
+)
+
+//Seller продавец
+type Seller struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+//Task запись журнала задач импорта
+type Task struct {
+	ID            int64
+	URL           string
+	SellerID      int
+	Status        string
+	ElapsedTime   string
+	LinesParsed   int
+	NewOffers     int
+	UpdatedOffers int
+	DeletedOffers int
+	Errors        int
+}
+
+//APIKey API ключ. Открытый ключ Key заполняется только при выпуске, хранится только хэш
+type APIKey struct {
+	ID        int64      `json:"id"`
+	SellerID  int        `json:"seller_id,omitempty"`
+	Role      string     `json:"role"`
+	Prefix    string     `json:"prefix"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+//AuditEntry запись журнала аудита
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	KeyID      int64     `json:"key_id,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	SellerID   int       `json:"seller_id,omitempty"`
+	Status     int       `json:"status"`
+	Outcome    string    `json:"outcome"`
+	RemoteAddr string    `json:"remote_addr"`
+}
+
+//OfferSearch условия поиска товаров, нулевые поля не учитываются
+type OfferSearch struct {
+	OfferID    int
+	SellerID   int
+	NameSearch string
+	//AsOf ищет товары в состоянии на этот момент по истории изменений
+	AsOf time.Time
+}
+
+//OfferEvent запись истории товара. Old равен nil для добавленного товара, New равен nil для удаленного.
+//TaskID равен 0, если товар изменен не импортом
+type OfferEvent struct {
+	ID        int64
+	SellerID  int
+	OfferID   int
+	TaskID    int64
+	CreatedAt time.Time
+	Old       *parser.Offer
+	New       *parser.Offer
+}
+
+//TaskFilter условия выборки задач, нулевые поля не учитываются
+type TaskFilter struct {
+	SellerID int
+	Status   string
+}
+
+//AuditFilter условия выборки журнала аудита, нулевые поля не учитываются
+type AuditFilter struct {
+	SellerID   int
+	KeyID      int64
+	Role       string
+	Method     string
+	PathPrefix string
+	Outcome    string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+//OfferDiff изменение товара импортом. Old равен nil для нового товара, New равен nil для удаляемого
+type OfferDiff struct {
+	OfferID int
+	Old     *parser.Offer
+	New     *parser.Offer
+}
+
+//DiffOffers сравнивает товары файла offers с текущими товарами продавца current и возвращает изменения по возрастанию ID.
+//Товары без изменений не входят в результат, из повторяющихся в файле ID учитывается последний, как при UpsertOffers.
+//Если replace, товары продавца, которых нет в файле, удаляются
+func DiffOffers(sellerID int, current, offers []parser.Offer, replace bool) []OfferDiff {
+	next := make(map[int]parser.Offer, len(offers))
+	for _, offer := range offers {
+		offer.SellerID = sellerID
+		next[offer.OfferID] = offer
+	}
+	diffs := []OfferDiff{}
+	for _, old := range current {
+		offer, ok := next[old.OfferID]
+		delete(next, old.OfferID)
+		switch {
+		case !ok && replace:
+			diffs = append(diffs, OfferDiff{OfferID: old.OfferID, Old: &old})
+		case ok && offer != old:
+			diffs = append(diffs, OfferDiff{OfferID: old.OfferID, Old: &old, New: &offer})
+		}
+	}
+	for id, offer := range next {
+		diffs = append(diffs, OfferDiff{OfferID: id, New: &offer})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].OfferID < diffs[j].OfferID })
+	return diffs
+}
+
+//CountDiffs считает новые, измененные и удаляемые товары
+func CountDiffs(diffs []OfferDiff) (inserts int, updates int, deletes int) {
+	for _, d := range diffs {
+		switch {
+		case d.Old == nil:
+			inserts++
+		case d.New == nil:
+			deletes++
+		default:
+			updates++
+		}
+	}
+	return inserts, updates, deletes
+}
+
+//OfferChange вычисляет новое состояние товара по текущему.
+//current равен nil, если товара нет; возвращенный nil означает удаление
+type OfferChange func(current *parser.Offer) (*parser.Offer, error)
+
+//OfferStore хранилище товаров. SellerID в возвращаемых товарах заполнен
+type OfferStore interface {
+	GetOffer(ctx context.Context, sellerID int, offerID int) (*parser.Offer, error)
+	SearchOffers(ctx context.Context, search OfferSearch) ([]parser.Offer, error)
+	//UpsertOffers добавляет новые товары продавца и обновляет изменившиеся.
+	//Изменения записываются в историю с задачей taskID, так же в остальных методах
+	UpsertOffers(ctx context.Context, sellerID int, taskID int64, offers []parser.Offer) (inserts int, updates int, err error)
+	//ChangeOffer атомарно читает товар, применяет change и записывает результат с задачей taskID.
+	//Ошибка change прерывает изменение и возвращается как есть
+	ChangeOffer(ctx context.Context, sellerID int, offerID int, taskID int64, change OfferChange) error
+	//ApplyOfferDiffs записывает изменения одной транзакцией. Если хоть один текущий товар не равен Old,
+	//ничего не записывается и возвращается ErrChanged
+	ApplyOfferDiffs(ctx context.Context, sellerID int, taskID int64, diffs []OfferDiff) error
+	//OfferHistory возвращает историю товара от старых изменений к новым
+	OfferHistory(ctx context.Context, sellerID int, offerID int) ([]OfferEvent, error)
+	//TaskHistory возвращает изменения товаров, записанные задачей, по порядку записи
+	TaskHistory(ctx context.Context, taskID int64) ([]OfferEvent, error)
+	//TaskSnapshot возвращает товары продавца по возрастанию ID такими, какими они стали после последнего
+	//изменения задачи taskID. Задача без изменений товаров получает снимок после ближайшей предыдущей
+	//задачи продавца с изменениями, а если такой нет, пустой список
+	TaskSnapshot(ctx context.Context, sellerID int, taskID int64) ([]parser.Offer, error)
+}
+
+//TaskStore журнал задач импорта
+type TaskStore interface {
+	//CreateTask добавляет задачу в статусе TaskProcessing
+	CreateTask(ctx context.Context, url string, sellerID int) (int64, error)
+	GetTask(ctx context.Context, taskID int64) (*Task, error)
+	//ListTasks возвращает задачи по возрастанию ID
+	ListTasks(ctx context.Context, filter TaskFilter) ([]Task, error)
+	//UpdateTask записывает статус и счетчики задачи
+	UpdateTask(ctx context.Context, task Task) error
+	//ClaimTask атомарно переводит задачу из TaskQueued в TaskProcessing.
+	//false означает, что задача уже не в очереди, например ее забрал другой сервер
+	ClaimTask(ctx context.Context, taskID int64) (bool, error)
+	//SavePreview сохраняет изменения пробного импорта задачи
+	SavePreview(ctx context.Context, taskID int64, diffs []OfferDiff) error
+	//ListPreview возвращает сохраненные изменения задачи по возрастанию ID товара,
+	//не больше limit, начиная с offset. limit 0 означает все изменения
+	ListPreview(ctx context.Context, taskID int64, offset int, limit int) ([]OfferDiff, error)
+}
+
+//SellerStore хранилище продавцов
+type SellerStore interface {
+	//CreateSeller добавляет продавца и заполняет CreatedAt, ErrConflict если он уже есть
+	CreateSeller(ctx context.Context, seller *Seller) error
+	GetSeller(ctx context.Context, sellerID int) (*Seller, error)
+	//ListSellers возвращает всех продавцов или одного, если sellerID не 0
+	ListSellers(ctx context.Context, sellerID int) ([]Seller, error)
+	UpdateSeller(ctx context.Context, seller Seller) error
+	//DeleteSeller удаляет продавца вместе с его товарами, задачами и ключами
+	DeleteSeller(ctx context.Context, sellerID int) error
+}
+
+//KeyStore хранилище API ключей
+type KeyStore interface {
+	//CreateAPIKey сохраняет ключ с хэшем и заполняет ID и CreatedAt
+	CreateAPIKey(ctx context.Context, key *APIKey, hash string) error
+	GetAPIKey(ctx context.Context, keyID int64) (*APIKey, error)
+	//FindAPIKey ищет действующий ключ по хэшу
+	FindAPIKey(ctx context.Context, hash string) (*APIKey, error)
+	//ListAPIKeys возвращает все ключи или ключи продавца, если sellerID не 0
+	ListAPIKeys(ctx context.Context, sellerID int) ([]APIKey, error)
+	//RevokeAPIKey отзывает действующий ключ
+	RevokeAPIKey(ctx context.Context, keyID int64) error
+	//RotateAPIKey атомарно отзывает действующий ключ и сохраняет next
+	RotateAPIKey(ctx context.Context, keyID int64, next *APIKey, hash string) error
+}
+
+//AuditStore журнал аудита, записи только добавляются
+type AuditStore interface {
+	AppendAudit(ctx context.Context, entry *AuditEntry) error
+	//ListAudit возвращает записи от новых к старым
+	ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+}
+
+//Store все хранилища сервиса
+type Store interface {
+	OfferStore
+	TaskStore
+	SellerStore
+	KeyStore
+	AuditStore
+	//Ping проверяет, что хранилище доступно
+	Ping(ctx context.Context) error
+	Close() error
+}
@@ -0,0 +1,42 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+//Commit и BuildTime задаются при сборке:
+//go build -ldflags "-X github.com/goserg/Golang-merchant-API/version.Commit=$(git rev-parse HEAD) -X github.com/goserg/Golang-merchant-API/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Commit    string
+	BuildTime string
+)
+
+//Info сведения о сборке сервера
+type Info struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+//Get возвращает сведения о сборке. Если они не заданы при сборке, берутся из данных VCS, которые добавляет go build
+func Get() Info {
+	info := Info{Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}